@@ -0,0 +1,33 @@
+// Details of the build that produced the running binary
+//
+// The variables are set at build time, e.g.
+//
+//	go build -ldflags "-X src/internal/buildinfo.Version=v1.2.3 -X src/internal/buildinfo.Commit=$(git rev-parse --short HEAD) -X src/internal/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without these flags (e.g. `go run`) report the placeholder values.
+package buildinfo
+
+import "runtime"
+
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get the details of the running build
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,187 @@
+package pdf
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/signintech/gopdf/fontmaker/core"
+)
+
+//go:embed fonts/PermanentMarker-Regular.ttf
+var permanentMarkerRegular []byte
+
+//go:embed fonts/Rubik-Regular.ttf
+var rubikRegular []byte
+
+// names of the fonts embedded in the binary, for use in `FontConfig`
+const (
+	FONT_PERMANENT_MARKER = "PermanentMarker-Regular"
+	FONT_RUBIK            = "Rubik-Regular"
+)
+
+var embeddedFonts = map[string][]byte{
+	FONT_PERMANENT_MARKER: permanentMarkerRegular,
+	FONT_RUBIK:            rubikRegular,
+}
+
+const (
+	DEFAULT_TITLE_FONT_SIZE = 14
+	DEFAULT_BODY_FONT_SIZE  = 10
+	// the label is only 72pt tall; anything outside this range is either unreadable or won't fit
+	MIN_FONT_SIZE = 4
+	MAX_FONT_SIZE = 36
+)
+
+// Fonts used to render a label
+//
+// The title font is used for the label text, and the body font for the date descriptor and date.
+// Each font is either one of the embedded fonts, selected by name, or caller-supplied TrueType data.
+// Zero values fall back to the default label style.
+type FontConfig struct {
+	// name of an embedded font; defaults to `FONT_PERMANENT_MARKER`
+	TitleFont string
+	// TrueType font data; when set, takes precedence over `TitleFont`
+	TitleFontData []byte
+	// defaults to `DEFAULT_TITLE_FONT_SIZE`
+	TitleFontSize float64
+
+	// name of an embedded font; defaults to `FONT_RUBIK`
+	BodyFont string
+	// TrueType font data; when set, takes precedence over `BodyFont`
+	BodyFontData []byte
+	// defaults to `DEFAULT_BODY_FONT_SIZE`
+	BodyFontSize float64
+}
+
+// a font which has been parsed and is ready for rendering
+type resolvedFont struct {
+	data []byte
+	size float64
+	// the characters the font can render, mapped to their glyph index
+	glyphs map[int]uint
+}
+
+// load and validate the title and body fonts described by the config
+func (fc FontConfig) resolve() (title resolvedFont, body resolvedFont, err error) {
+	title, err = loadFont(fc.TitleFont, fc.TitleFontData, fc.TitleFontSize, FONT_PERMANENT_MARKER, DEFAULT_TITLE_FONT_SIZE)
+	if err != nil {
+		return title, body, fmt.Errorf("title font: %w", err)
+	}
+
+	body, err = loadFont(fc.BodyFont, fc.BodyFontData, fc.BodyFontSize, FONT_RUBIK, DEFAULT_BODY_FONT_SIZE)
+	if err != nil {
+		return title, body, fmt.Errorf("body font: %w", err)
+	}
+
+	return title, body, nil
+}
+
+func loadFont(name string, data []byte, size float64, defaultName string, defaultSize float64) (resolvedFont, error) {
+	if size == 0 {
+		size = defaultSize
+	}
+	if size < MIN_FONT_SIZE || size > MAX_FONT_SIZE {
+		return resolvedFont{}, fmt.Errorf("font size %v is outside the supported range of %v to %v", size, MIN_FONT_SIZE, MAX_FONT_SIZE)
+	}
+
+	// caller-supplied fonts are parsed every time; they may be different on each call
+	if data != nil {
+		glyphs, err := parseGlyphs(data)
+		if err != nil {
+			return resolvedFont{}, fmt.Errorf("unable to load font: %w", err)
+		}
+		return resolvedFont{data: data, size: size, glyphs: glyphs}, nil
+	}
+
+	if name == "" {
+		name = defaultName
+	}
+	data, ok := embeddedFonts[name]
+	if !ok {
+		return resolvedFont{}, errors.New("unknown font: " + name)
+	}
+
+	glyphs, err := embeddedGlyphs(name, data)
+	if err != nil {
+		return resolvedFont{}, fmt.Errorf("unable to load font %v: %w", name, err)
+	}
+
+	return resolvedFont{data: data, size: size, glyphs: glyphs}, nil
+}
+
+// Parse every embedded font, so a build with a missing or corrupt font fails at startup rather than on the first print
+//
+// The parsed glyph tables are cached, so later generations don't parse the embedded fonts again.
+func ValidateFonts() error {
+	for _, name := range []string{FONT_PERMANENT_MARKER, FONT_RUBIK} {
+		if _, err := embeddedGlyphs(name, embeddedFonts[name]); err != nil {
+			return fmt.Errorf("unable to load embedded font %v: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// the embedded fonts never change, so their glyph tables are only parsed once
+var (
+	embeddedGlyphsMu    sync.Mutex
+	embeddedGlyphsCache = make(map[string]map[int]uint)
+)
+
+func embeddedGlyphs(name string, data []byte) (map[int]uint, error) {
+	embeddedGlyphsMu.Lock()
+	defer embeddedGlyphsMu.Unlock()
+
+	if glyphs, ok := embeddedGlyphsCache[name]; ok {
+		return glyphs, nil
+	}
+
+	glyphs, err := parseGlyphs(data)
+	if err != nil {
+		return nil, err
+	}
+	embeddedGlyphsCache[name] = glyphs
+
+	return glyphs, nil
+}
+
+func parseGlyphs(data []byte) (map[int]uint, error) {
+	var p core.TTFParser
+	if err := p.ParseFontData(data); err != nil {
+		return nil, err
+	}
+
+	return p.Chars(), nil
+}
+
+// find the characters in `text` that the font has no glyph for; each character is reported once, in order of appearance
+func (f resolvedFont) unsupportedCharacters(text string) []rune {
+	var missing []rune
+	for _, r := range text {
+		// glyph 0 is the font's "missing character" box
+		if f.glyphs[int(r)] == 0 && !strings.ContainsRune(string(missing), r) {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing
+}
+
+// Returned when text contains characters that the label fonts have no glyphs for
+//
+// Rather than silently dropping these characters (which is what gopdf does), generation fails so the caller can ask for different text.
+type UnsupportedCharactersError struct {
+	Characters []rune
+}
+
+func (e *UnsupportedCharactersError) Error() string {
+	quoted := make([]string, len(e.Characters))
+	for i, r := range e.Characters {
+		quoted[i] = fmt.Sprintf("%q", r)
+	}
+
+	return "text contains characters that can't be printed: " + strings.Join(quoted, ", ")
+}
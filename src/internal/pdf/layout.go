@@ -0,0 +1,158 @@
+package pdf
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/signintech/gopdf"
+)
+
+type lineRole int
+
+const (
+	roleTitle lineRole = iota
+	roleDescriptor
+	roleDate
+)
+
+// a line of text and where it goes on the label
+type textLine struct {
+	// "title" or "body"
+	font string
+	size float64
+	// decides the line's color
+	role lineRole
+	y    float64
+	text string
+}
+
+// the label text across the top, with the date lines anchored to the bottom
+func landscapeLayout(titleFont resolvedFont, bodyFont resolvedFont, labelText string, dateDescriptor string, date string, useBy string) []textLine {
+
+	// a "use by" line pushes the others up and caps the font size so that all three lines fit below the label text
+	descriptorY, dateY := 43.0, 55.0
+	if useBy != "" {
+		descriptorY, dateY = 32, 43
+		bodyFont.size = math.Min(bodyFont.size, DEFAULT_BODY_FONT_SIZE)
+	}
+
+	// describe what the date information corresponds to (made, bought, etc) above the date
+	lines := []textLine{
+		{font: "title", size: titleFont.size, role: roleTitle, y: 10, text: labelText},
+		{font: "body", size: bodyFont.size, role: roleDescriptor, y: descriptorY, text: dateDescriptor},
+		{font: "body", size: bodyFont.size, role: roleDate, y: dateY, text: date},
+	}
+	if useBy != "" {
+		lines = append(lines, textLine{font: "body", size: bodyFont.size, role: roleDate, y: 54, text: useBy})
+	}
+
+	return lines
+}
+
+// where the label text starts in portrait labels
+const portraitTitleY = 10.0
+
+// like the landscape layout, but the label is too narrow for most text, so every line is wrapped to fit
+//
+// Dates read badly when broken mid-word, so the body font shrinks until each word of the date lines fits on a line of its own.
+// The title font then shrinks until the label text clears the date lines.
+func portraitLayout(pdf *gopdf.GoPdf, titleFont resolvedFont, bodyFont resolvedFont, labelText string, dateDescriptor string, date string, useBy string) ([]textLine, error) {
+	width := float64(PAGE_HEIGHT - 2*PAGE_MARGIN)
+
+	for {
+		fits, err := wordsFit(pdf, "body", bodyFont.size, date+" "+useBy, width)
+		if err != nil {
+			return nil, err
+		}
+		if fits || bodyFont.size <= MIN_FONT_SIZE {
+			break
+		}
+		bodyFont.size = math.Max(bodyFont.size-1, MIN_FONT_SIZE)
+	}
+
+	var bottom []textLine
+	for _, part := range []struct {
+		role lineRole
+		text string
+	}{{roleDescriptor, dateDescriptor}, {roleDate, date}, {roleDate, useBy}} {
+		wrapped, err := wrapText(pdf, "body", bodyFont.size, part.text, width)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range wrapped {
+			bottom = append(bottom, textLine{font: "body", size: bodyFont.size, role: part.role, text: t})
+		}
+	}
+
+	// stack the date lines upwards from the bottom margin
+	lastY := PAGE_WIDTH - PAGE_MARGIN - bodyFont.size
+	for i := range bottom {
+		bottom[i].y = lastY - float64(len(bottom)-1-i)*bodyFont.size*LINE_SPACING
+	}
+
+	for {
+		titleLines, err := wrapText(pdf, "title", titleFont.size, labelText, width)
+		if err != nil {
+			return nil, err
+		}
+
+		titleBottom := portraitTitleY + float64(len(titleLines)-1)*titleFont.size*LINE_SPACING + titleFont.size
+		if len(bottom) == 0 || titleBottom <= bottom[0].y {
+			var lines []textLine
+			for i, t := range titleLines {
+				lines = append(lines, textLine{font: "title", size: titleFont.size, role: roleTitle, y: portraitTitleY + float64(i)*titleFont.size*LINE_SPACING, text: t})
+			}
+			return append(lines, bottom...), nil
+		}
+
+		if titleFont.size <= MIN_FONT_SIZE {
+			return nil, errors.New("label text is too long to fit on a portrait label")
+		}
+		titleFont.size = math.Max(titleFont.size-1, MIN_FONT_SIZE)
+	}
+}
+
+// word wrap `text` to `width` in the given font; words wider than `width` are broken wherever they need to be
+func wrapText(pdf *gopdf.GoPdf, font string, size float64, text string, width float64) ([]string, error) {
+	if err := pdf.SetFont(font, "", size); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	wrapped, err := pdf.SplitTextWithWordWrap(text, width)
+	if err != nil {
+		return nil, err
+	}
+
+	// gopdf leaves the space it broke the line at on the start of the next line
+	var lines []string
+	for _, l := range wrapped {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return lines, nil
+}
+
+// check that each word of `text` fits within `width` in the given font
+func wordsFit(pdf *gopdf.GoPdf, font string, size float64, text string, width float64) (bool, error) {
+	if err := pdf.SetFont(font, "", size); err != nil {
+		return false, err
+	}
+
+	for _, word := range strings.Fields(text) {
+		w, err := pdf.MeasureTextWidth(word)
+		if err != nil {
+			return false, err
+		}
+		if w > width {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
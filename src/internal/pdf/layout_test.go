@@ -0,0 +1,127 @@
+package pdf
+
+import (
+	"testing"
+	"time"
+)
+
+// lay out a portrait label with the default fonts, returning the document so the lines can be measured
+func portraitLines(t *testing.T, labelText string, dateDescriptor string, opts Options) ([]textLine, func(textLine) float64) {
+	t.Helper()
+
+	titleFont, bodyFont, err := opts.Fonts.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, err := opts.FormattedDate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	useBy, err := opts.FormattedUseByDate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if useBy != "" {
+		useBy = USE_BY_DESCRIPTOR + " " + useBy
+	}
+
+	pdf, err := newDocument(PAGE_HEIGHT, PAGE_WIDTH, titleFont, bodyFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := portraitLayout(pdf, titleFont, bodyFont, labelText, dateDescriptor, date, useBy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := func(l textLine) float64 {
+		if err := pdf.SetFont(l.font, "", l.size); err != nil {
+			t.Fatal(err)
+		}
+		w, err := pdf.MeasureTextWidth(l.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	return lines, width
+}
+
+// every line should fit between the margins, without stray spaces, and below the line before it
+func checkPortraitLines(t *testing.T, lines []textLine, width func(textLine) float64) {
+	t.Helper()
+
+	for i, l := range lines {
+		if w := width(l); w > PAGE_HEIGHT-2*PAGE_MARGIN {
+			t.Errorf("line %q is %.1fpt wide, wider than the label", l.text, w)
+		}
+		if l.text == "" || l.text[0] == ' ' || l.text[len(l.text)-1] == ' ' {
+			t.Errorf("line %q has stray spaces", l.text)
+		}
+		if l.y < PAGE_MARGIN || l.y+l.size > PAGE_WIDTH-PAGE_MARGIN {
+			t.Errorf("line %q at %.1fpt runs off the label", l.text, l.y)
+		}
+		if i > 0 && l.y < lines[i-1].y+lines[i-1].size {
+			t.Errorf("line %q overlaps %q", l.text, lines[i-1].text)
+		}
+	}
+}
+
+func lineTexts(lines []textLine) []string {
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	return texts
+}
+
+// a portrait label with a "use by" date and a date layout that includes the time, as on the test page
+func TestPortraitLayout_UseByDate(t *testing.T) {
+	shelfLife := 5
+	opts := Options{
+		Date:          time.Date(2023, 12, 27, 18, 30, 0, 0, time.UTC),
+		Location:      time.UTC,
+		DateLayout:    "2006-01-02 15:04",
+		ShelfLifeDays: &shelfLife,
+	}
+
+	lines, width := portraitLines(t, "Chicken noodle soup", "made:", opts)
+	checkPortraitLines(t, lines, width)
+
+	want := []string{"Chicken", "noodle", "soup", "made:", "2023-12-27", "18:30", "use by:", "2024-01-01", "18:30"}
+	got := lineTexts(lines)
+	if len(got) != len(want) {
+		t.Fatalf("unexpected lines: got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected lines: got %q, want %q", got, want)
+		}
+	}
+
+	// the date lines share a font size, and the last one sits on the bottom margin
+	last := lines[len(lines)-1]
+	if last.y+last.size != PAGE_WIDTH-PAGE_MARGIN {
+		t.Errorf("last line should end at the bottom margin, ends at %.1fpt", last.y+last.size)
+	}
+}
+
+// long text in large fonts should be shrunk until nothing overlaps or runs off the label
+func TestPortraitLayout_LongText(t *testing.T) {
+	shelfLife := 30
+	opts := Options{
+		Date:          time.Date(2023, 12, 27, 18, 30, 0, 0, time.UTC),
+		Location:      time.UTC,
+		DateLayout:    "Monday, January 2, 2006",
+		ShelfLifeDays: &shelfLife,
+		Fonts:         FontConfig{TitleFontSize: 30, BodyFontSize: 16},
+	}
+
+	lines, width := portraitLines(t, "Spaghettibolognese", "bought at the market:", opts)
+	checkPortraitLines(t, lines, width)
+
+	if lines[0].size >= 30 {
+		t.Errorf("expected the title font to shrink, got %vpt", lines[0].size)
+	}
+}
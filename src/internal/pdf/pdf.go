@@ -4,7 +4,10 @@ import (
 	"bytes"
 	_ "embed"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/signintech/gopdf"
 )
@@ -15,79 +18,285 @@ const (
 	PAGE_MARGIN = 8
 )
 
-//go:embed fonts/PermanentMarker-Regular.ttf
-var permanentMarkerRegular []byte
+// the label's layout; landscape is the label roll's natural reading direction
+const (
+	ORIENTATION_LANDSCAPE = "landscape"
+	ORIENTATION_PORTRAIT  = "portrait"
+)
 
-//go:embed fonts/Rubik-Regular.ttf
-var rubikRegular []byte
+// distance between wrapped lines, as a multiple of the font size
+const LINE_SPACING = 1.2
 
 const DEFAULT_DATE_DESCRIPTOR = "made:"
+const DEFAULT_DATE_LAYOUT = time.DateOnly
+const USE_BY_DESCRIPTOR = "use by:"
+
+// Optional settings for PDF generation; the zero value renders today's local date as YYYY-MM-DD
+type Options struct {
+	// layout string as accepted by `time.Time.Format`; defaults to `DEFAULT_DATE_LAYOUT`
+	DateLayout string
+	// timezone in which the date is rendered; defaults to `time.Local`
+	Location *time.Location
+	// the date to print on the label; defaults to the current time
+	Date time.Time
+	// fonts and font sizes; the zero value uses the default label style
+	Fonts FontConfig
+	// when set, a "use by" date this many days after `Date` is added to the label
+	ShelfLifeDays *int
+	// `ORIENTATION_LANDSCAPE` or `ORIENTATION_PORTRAIT`; defaults to landscape
+	Orientation string
+	// text colors; the zero value uses the default label style
+	Style Style
+}
+
+// An RGB color; each channel is from 0 to 255
+type Color struct {
+	R, G, B int
+}
+
+// Text colors used to render a label, e.g. for contrast on colored label stock; nil colors use the defaults
+type Style struct {
+	// color of the label text; defaults to `DEFAULT_TITLE_COLOR`
+	TitleColor *Color
+	// color of the date descriptor, date and "use by" date; defaults to `DEFAULT_DESCRIPTOR_COLOR` for the descriptor
+	// and `DEFAULT_DATE_COLOR` for the dates
+	DateColor *Color
+}
+
+var (
+	DEFAULT_TITLE_COLOR      = Color{0, 0, 0}
+	DEFAULT_DESCRIPTOR_COLOR = Color{85, 85, 85}
+	DEFAULT_DATE_COLOR       = Color{0, 0, 0}
+)
+
+// Ensure every channel of the color is within 0-255
+func (c Color) Validate() error {
+	for _, v := range []int{c.R, c.G, c.B} {
+		if v < 0 || v > 255 {
+			return fmt.Errorf("color channel out of range: %v is not between 0 and 255", v)
+		}
+	}
+
+	return nil
+}
+
+// the color of each kind of text line, with defaults filled in
+func (s Style) colors() (map[lineRole]Color, error) {
+	colors := map[lineRole]Color{
+		roleTitle:      DEFAULT_TITLE_COLOR,
+		roleDescriptor: DEFAULT_DESCRIPTOR_COLOR,
+		roleDate:       DEFAULT_DATE_COLOR,
+	}
+
+	if s.TitleColor != nil {
+		if err := s.TitleColor.Validate(); err != nil {
+			return nil, fmt.Errorf("title color: %w", err)
+		}
+		colors[roleTitle] = *s.TitleColor
+	}
+	if s.DateColor != nil {
+		if err := s.DateColor.Validate(); err != nil {
+			return nil, fmt.Errorf("date color: %w", err)
+		}
+		colors[roleDescriptor], colors[roleDate] = *s.DateColor, *s.DateColor
+	}
+
+	return colors, nil
+}
+
+// Ensure `orientation` is one of the supported label orientations; empty means the default
+func ValidateOrientation(orientation string) error {
+	switch orientation {
+	case "", ORIENTATION_LANDSCAPE, ORIENTATION_PORTRAIT:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported orientation %q: must be %q or %q", orientation, ORIENTATION_LANDSCAPE, ORIENTATION_PORTRAIT)
+}
+
+// Report whether `text` is free of control characters, invisible formatting characters and line breaks, any of which would
+// garble the single-line layout; other spaces, such as non-breaking spaces, are fine
+func IsPrintable(text string) bool {
+	for _, r := range text {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Cf, unicode.Zl, unicode.Zp) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Ensure `labelText` can be rendered by the title font, without generating a label
+func ValidateLabelText(labelText string, fonts FontConfig) error {
+	if !IsPrintable(labelText) {
+		return errors.New("contains characters that can't be printed, such as line breaks or tabs")
+	}
+
+	titleFont, _, err := fonts.resolve()
+	if err != nil {
+		return err
+	}
+	if missing := titleFont.unsupportedCharacters(labelText); len(missing) > 0 {
+		return &UnsupportedCharactersError{Characters: missing}
+	}
+
+	return nil
+}
+
+// Ensure `dateDescriptor` can be rendered by the body font, without generating a label
+func ValidateDateDescriptor(dateDescriptor string, fonts FontConfig) error {
+	if !IsPrintable(dateDescriptor) {
+		return errors.New("contains characters that can't be printed, such as line breaks or tabs")
+	}
+
+	_, bodyFont, err := fonts.resolve()
+	if err != nil {
+		return err
+	}
+	if missing := bodyFont.unsupportedCharacters(dateDescriptor); len(missing) > 0 {
+		return &UnsupportedCharactersError{Characters: missing}
+	}
+
+	return nil
+}
+
+// Render the date described by the options as it will appear on the label
+func (o Options) FormattedDate() (string, error) {
+	return o.formatDate(0)
+}
+
+// Render the "use by" date as it will appear on the label; empty if no shelf life is set
+func (o Options) FormattedUseByDate() (string, error) {
+	if o.ShelfLifeDays == nil {
+		return "", nil
+	}
+
+	return o.formatDate(*o.ShelfLifeDays)
+}
+
+// render the label date, offset by `days`, in the configured layout and timezone
+func (o Options) formatDate(days int) (string, error) {
+	layout := o.DateLayout
+	if layout == "" {
+		layout = DEFAULT_DATE_LAYOUT
+	}
+
+	loc := o.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	date := o.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	// add calendar days in the label's timezone so DST changes don't shift the date
+	d := date.In(loc).AddDate(0, 0, days).Format(layout)
+	if strings.TrimSpace(d) == "" {
+		return "", errors.New("date layout produces an empty date: " + layout)
+	}
+
+	return d, nil
+}
 
 // Generate a PDF document consisting of the provided `labelText`, optional `dateDescriptor`, and the current date
 func GeneratePdf(labelText string, dateDescriptor string) ([]byte, error) {
+	return GeneratePdfWithOptions(labelText, dateDescriptor, Options{})
+}
+
+// Generate a PDF document like `GeneratePdf`, but rendered with the given fonts
+func GeneratePdfWithFonts(labelText string, dateDescriptor string, fonts FontConfig) ([]byte, error) {
+	return GeneratePdfWithOptions(labelText, dateDescriptor, Options{Fonts: fonts})
+}
+
+// Generate a PDF document like `GeneratePdf`, but rendered in the given colors
+func GeneratePdfWithStyle(labelText string, dateDescriptor string, style Style) ([]byte, error) {
+	return GeneratePdfWithOptions(labelText, dateDescriptor, Options{Style: style})
+}
+
+// Generate a PDF document consisting of the provided `labelText`, optional `dateDescriptor`, and the date described by `opts`
+func GeneratePdfWithOptions(labelText string, dateDescriptor string, opts Options) ([]byte, error) {
 
 	// ensure dateDescriptor isn't empty: if not provided, set to the default value
 	if dateDescriptor == "" {
 		dateDescriptor = DEFAULT_DATE_DESCRIPTOR
 	}
 
-	// initialize PDF
-	pdf := gopdf.GoPdf{}
-	pdf.Start(gopdf.Config{PageSize: gopdf.Rect{W: PAGE_WIDTH, H: PAGE_HEIGHT}})
-	pdf.AddPage()
-
-	// load the (embedded) font file for adding text to the document
-	pmr := bytes.NewReader(permanentMarkerRegular)
-	err := pdf.AddTTFFontByReader("PermanentMarker-Regular", pmr)
-	if err != nil {
+	if err := ValidateOrientation(opts.Orientation); err != nil {
 		return nil, err
 	}
-	rr := bytes.NewReader(rubikRegular)
-	err = pdf.AddTTFFontByReader("Rubik-Regular", rr)
+
+	colors, err := opts.Style.colors()
 	if err != nil {
 		return nil, err
 	}
 
-	err = pdf.SetFont("Rubik-Regular", "", 16)
+	// resolve the date up front so a bad layout fails before any rendering work is done
+	date, err := opts.FormattedDate()
 	if err != nil {
 		return nil, err
 	}
 
-	// write the label text in the upper-left corner of the document
-	pdf.SetXY(PAGE_MARGIN, 10)
-	pdf.SetTextColor(0, 0, 0)
-	err = pdf.SetFont("PermanentMarker-Regular", "", 14)
+	useBy, err := opts.FormattedUseByDate()
 	if err != nil {
 		return nil, err
 	}
-	err = pdf.Cell(nil, labelText)
-	if err != nil {
-		return nil, err
+	if useBy != "" {
+		useBy = USE_BY_DESCRIPTOR + " " + useBy
 	}
 
-	// describe what the date information corresponds to (made, bought, etc) in the lower-left corner of the document
-	pdf.SetXY(PAGE_MARGIN, 43)
-	pdf.SetTextColor(85, 85, 85)
-	err = pdf.SetFont("Rubik-Regular", "", 10)
+	titleFont, bodyFont, err := opts.Fonts.resolve()
 	if err != nil {
 		return nil, err
 	}
-	err = pdf.Cell(nil, dateDescriptor)
-	if err != nil {
-		return nil, err
+
+	// make sure every character has a glyph in the font it will be rendered with
+	missing := titleFont.unsupportedCharacters(labelText)
+	for _, r := range bodyFont.unsupportedCharacters(dateDescriptor + date + useBy) {
+		if !strings.ContainsRune(string(missing), r) {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &UnsupportedCharactersError{Characters: missing}
 	}
 
-	pdf.SetXY(PAGE_MARGIN, 55)
-	pdf.SetTextColor(0, 0, 0)
-	err = pdf.SetFont("Rubik-Regular", "", 10)
-	if err != nil {
-		return nil, err
+	// initialize PDF; portrait labels are the landscape page turned on its side
+	pageWidth, pageHeight := float64(PAGE_WIDTH), float64(PAGE_HEIGHT)
+	if opts.Orientation == ORIENTATION_PORTRAIT {
+		pageWidth, pageHeight = pageHeight, pageWidth
 	}
-	err = pdf.Cell(nil, time.Now().Local().Format(time.DateOnly))
+	pdf, err := newDocument(pageWidth, pageHeight, titleFont, bodyFont)
 	if err != nil {
 		return nil, err
 	}
 
+	var lines []textLine
+	switch opts.Orientation {
+	case ORIENTATION_PORTRAIT:
+		lines, err = portraitLayout(pdf, titleFont, bodyFont, labelText, dateDescriptor, date, useBy)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		lines = landscapeLayout(titleFont, bodyFont, labelText, dateDescriptor, date, useBy)
+	}
+
+	for _, l := range lines {
+		pdf.SetXY(PAGE_MARGIN, l.y)
+		c := colors[l.role]
+		pdf.SetTextColor(uint8(c.R), uint8(c.G), uint8(c.B))
+		err = pdf.SetFont(l.font, "", l.size)
+		if err != nil {
+			return nil, err
+		}
+		err = pdf.Cell(nil, l.text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// write the document to a byte buffer
 	b := bytes.NewBuffer([]byte{})
 	if n, err := pdf.WriteTo(b); err != nil || n == 0 {
@@ -96,3 +305,21 @@ func GeneratePdf(labelText string, dateDescriptor string) ([]byte, error) {
 
 	return b.Bytes(), nil
 }
+
+// start a single page document with the title and body fonts loaded
+func newDocument(pageWidth float64, pageHeight float64, titleFont resolvedFont, bodyFont resolvedFont) (*gopdf.GoPdf, error) {
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: gopdf.Rect{W: pageWidth, H: pageHeight}})
+	pdf.AddPage()
+
+	// load the fonts for adding text to the document; gopdf only reads the data, so the embedded bytes are handed over
+	// as they are rather than copied out of a reader on every call
+	if err := pdf.AddTTFFontData("title", titleFont.data); err != nil {
+		return nil, err
+	}
+	if err := pdf.AddTTFFontData("body", bodyFont.data); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
@@ -1,6 +1,8 @@
 package pdf_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,8 +11,6 @@ import (
 	"time"
 )
 
-const FILE_PATH = "./tmp"
-
 // Test a simple label with input that should definitely work
 func TestPdfGeneration_Simple(t *testing.T) {
 	// define test value(s)
@@ -27,7 +27,7 @@ func TestPdfGeneration_Simple(t *testing.T) {
 	// define target filePath
 	timeStamp := time.Now().UTC().UnixNano()
 	fileName := fmt.Sprintf("%v.pdf", timeStamp)
-	filePathName := filepath.Join(FILE_PATH, fileName)
+	filePathName := filepath.Join(t.TempDir(), fileName)
 	if err != nil {
 		// if this fails, it's not an issue with the function we're using, but rather the test code itself
 		t.Log("[meta] test error - unable to generate filename:", err.Error())
@@ -58,3 +58,273 @@ func TestPdfGeneration_Simple(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Render a label for an explicit date in a different timezone and layout
+func TestPdfGeneration_WithOptions(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone database unavailable:", err)
+	}
+
+	opts := pdf.Options{
+		DateLayout: "Jan 2, 2006",
+		Location:   loc,
+		// 2023-03-01 in Tokyo, but still 2023-02-28 in UTC
+		Date: time.Date(2023, 2, 28, 20, 0, 0, 0, time.UTC),
+	}
+
+	d, err := opts.FormattedDate()
+	if err != nil {
+		t.Fatal("Failed to format date:", err)
+	}
+	if d != "Mar 1, 2023" {
+		t.Errorf("unexpected date: got %q want %q", d, "Mar 1, 2023")
+	}
+
+	b, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", opts)
+	if err != nil {
+		t.Fatal("Failed to generate PDF:", err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+}
+
+// The zero value of Options renders today's local date
+func TestPdfGeneration_DefaultOptions(t *testing.T) {
+	d, err := pdf.Options{}.FormattedDate()
+	if err != nil {
+		t.Fatal("Failed to format date:", err)
+	}
+	if want := time.Now().Local().Format(time.DateOnly); d != want {
+		t.Errorf("unexpected date: got %q want %q", d, want)
+	}
+}
+
+// A layout that renders to nothing is rejected rather than producing a label without a date
+func TestPdfGeneration_EmptyDateLayout(t *testing.T) {
+	_, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", pdf.Options{DateLayout: "   "})
+	if err == nil {
+		t.Error("expected an error for a blank date layout")
+	}
+}
+
+// Accented Latin characters are covered by both fonts and should render normally
+func TestPdfGeneration_AccentedCharacters(t *testing.T) {
+	b, err := pdf.GeneratePdf("Crème brûlée", "préparé:")
+	if err != nil {
+		t.Fatal("Failed to generate PDF:", err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+}
+
+// Characters without a glyph (e.g. emoji) should produce a descriptive error rather than a label with blanks
+func TestPdfGeneration_UnsupportedCharacters(t *testing.T) {
+	_, err := pdf.GeneratePdf("Soup 🍲🍲", "made ✓")
+
+	var unsupported *pdf.UnsupportedCharactersError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected an UnsupportedCharactersError, got %v", err)
+	}
+	if string(unsupported.Characters) != "🍲✓" {
+		t.Errorf("unexpected unsupported characters: got %q want %q", string(unsupported.Characters), "🍲✓")
+	}
+	if want := `text contains characters that can't be printed: '🍲', '✓'`; err.Error() != want {
+		t.Errorf("unexpected error message: got %q want %q", err.Error(), want)
+	}
+}
+
+// Render the label text with an alternate embedded font and size, and with caller-supplied font data
+func TestPdfGeneration_WithFonts(t *testing.T) {
+	b, err := pdf.GeneratePdfWithFonts("Lorem ipsum dolor", "", pdf.FontConfig{
+		TitleFont:     pdf.FONT_RUBIK,
+		TitleFontSize: 12,
+	})
+	if err != nil {
+		t.Fatal("Failed to generate PDF with an alternate embedded font:", err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+
+	ttf, err := os.ReadFile("fonts/PermanentMarker-Regular.ttf")
+	if err != nil {
+		t.Fatal("[meta] test error - unable to read font file:", err)
+	}
+	b, err = pdf.GeneratePdfWithFonts("Lorem ipsum dolor", "", pdf.FontConfig{BodyFontData: ttf})
+	if err != nil {
+		t.Fatal("Failed to generate PDF with caller-supplied font data:", err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+}
+
+// Fonts that can't be loaded, and unreasonable sizes, are rejected before rendering
+func TestPdfGeneration_InvalidFonts(t *testing.T) {
+	configs := map[string]pdf.FontConfig{
+		"unknown embedded font": {TitleFont: "Comic-Sans"},
+		"invalid font data":     {BodyFontData: []byte("definitely not a TrueType font")},
+		"font size too small":   {TitleFontSize: 1},
+		"font size too large":   {BodyFontSize: 72},
+	}
+
+	for name, fc := range configs {
+		if _, err := pdf.GeneratePdfWithFonts("Lorem ipsum dolor", "", fc); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+// The fonts embedded in the binary should all parse
+func TestValidateFonts(t *testing.T) {
+	if err := pdf.ValidateFonts(); err != nil {
+		t.Errorf("embedded fonts failed to load: %v", err)
+	}
+}
+
+// Only characters which would break the single-line layout are rejected; unusual spaces are still text
+func TestIsPrintable(t *testing.T) {
+	tests := []struct {
+		text      string
+		printable bool
+	}{
+		{"crème brûlée", true},
+		{"made\u00a0on:", true},
+		{"thin\u2009space", true},
+		{"line\nbreak", false},
+		{"tab\there", false},
+		{"bell\u0007", false},
+		{"zero\u200bwidth", false},
+		{"right\u202eto left", false},
+		{"line\u2028separator", false},
+	}
+
+	for _, tt := range tests {
+		if got := pdf.IsPrintable(tt.text); got != tt.printable {
+			t.Errorf("IsPrintable(%q) = %v, want %v", tt.text, got, tt.printable)
+		}
+	}
+}
+
+// A shelf life adds a "use by" date, counted in calendar days from the label date
+func TestPdfGeneration_UseByDate(t *testing.T) {
+	shelfLife := 5
+	opts := pdf.Options{
+		Location:      time.UTC,
+		Date:          time.Date(2023, 2, 26, 12, 0, 0, 0, time.UTC),
+		ShelfLifeDays: &shelfLife,
+	}
+
+	d, err := opts.FormattedUseByDate()
+	if err != nil {
+		t.Fatal("Failed to format use by date:", err)
+	}
+	if d != "2023-03-03" {
+		t.Errorf("unexpected use by date: got %q want %q", d, "2023-03-03")
+	}
+
+	withUseBy, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", opts)
+	if err != nil {
+		t.Fatal("Failed to generate PDF with a use by date:", err)
+	}
+	if !bytes.HasPrefix(withUseBy, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+
+	// without a shelf life, there's no use by date
+	opts.ShelfLifeDays = nil
+	if d, err := opts.FormattedUseByDate(); err != nil || d != "" {
+		t.Errorf("expected no use by date, got %q (err: %v)", d, err)
+	}
+
+	withoutUseBy, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", opts)
+	if err != nil {
+		t.Fatal("Failed to generate PDF without a use by date:", err)
+	}
+	if bytes.Equal(withUseBy, withoutUseBy) {
+		t.Error("adding a use by date should change the generated document")
+	}
+}
+
+// both orientations should render valid PDFs, with the page turned on its side for portrait labels
+func TestPdfGeneration_Orientation(t *testing.T) {
+	shelfLife := 3
+	for orientation, mediaBox := range map[string]string{
+		"":                        "/MediaBox [ 0 0 153.00 72.00 ]",
+		pdf.ORIENTATION_LANDSCAPE: "/MediaBox [ 0 0 153.00 72.00 ]",
+		pdf.ORIENTATION_PORTRAIT:  "/MediaBox [ 0 0 72.00 153.00 ]",
+	} {
+		opts := pdf.Options{Orientation: orientation, ShelfLifeDays: &shelfLife}
+		b, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "best before:", opts)
+		if err != nil {
+			t.Fatalf("failed to generate a %q PDF: %v", orientation, err)
+		}
+		if !bytes.HasPrefix(b, []byte("%PDF-")) {
+			t.Errorf("generated %q document is not a PDF", orientation)
+		}
+		if !bytes.Contains(b, []byte(mediaBox)) {
+			t.Errorf("generated %q document doesn't have the page size %v", orientation, mediaBox)
+		}
+	}
+
+	if _, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", pdf.Options{Orientation: "diagonal"}); err == nil {
+		t.Error("expected an error for an unsupported orientation")
+	}
+}
+
+// colored text should change the document, and out-of-range channels should be rejected
+func TestPdfGeneration_WithStyle(t *testing.T) {
+	date := time.Date(2023, 2, 26, 12, 0, 0, 0, time.UTC)
+	plain, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", pdf.Options{Date: date, Location: time.UTC})
+	if err != nil {
+		t.Fatal("Failed to generate PDF:", err)
+	}
+
+	// the defaults spelled out should render the same document
+	defaults := pdf.Style{TitleColor: &pdf.DEFAULT_TITLE_COLOR}
+	same, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", pdf.Options{Date: date, Location: time.UTC, Style: defaults})
+	if err != nil {
+		t.Fatal("Failed to generate PDF with the default style:", err)
+	}
+	if !bytes.Equal(plain, same) {
+		t.Error("the default colors should render the same document as no style")
+	}
+
+	style := pdf.Style{TitleColor: &pdf.Color{R: 255, G: 255, B: 255}, DateColor: &pdf.Color{R: 0, G: 0, B: 128}}
+	colored, err := pdf.GeneratePdfWithOptions("Lorem ipsum dolor", "", pdf.Options{Date: date, Location: time.UTC, Style: style})
+	if err != nil {
+		t.Fatal("Failed to generate PDF with colors:", err)
+	}
+	if !bytes.HasPrefix(colored, []byte("%PDF-")) {
+		t.Error("generated document is not a PDF")
+	}
+	if bytes.Equal(plain, colored) {
+		t.Error("colors should change the generated document")
+	}
+
+	if _, err := pdf.GeneratePdfWithStyle("Lorem ipsum dolor", "", style); err != nil {
+		t.Error("Failed to generate PDF with GeneratePdfWithStyle:", err)
+	}
+
+	for _, invalid := range []pdf.Style{
+		{TitleColor: &pdf.Color{R: 256}},
+		{DateColor: &pdf.Color{G: -1}},
+	} {
+		if _, err := pdf.GeneratePdfWithStyle("Lorem ipsum dolor", "", invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+// Measures a typical label; run with `go test -bench . -benchmem ./internal/pdf` to compare allocations between changes
+func BenchmarkGeneratePdf(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := pdf.GeneratePdf("Lorem ipsum dolor", "made:"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
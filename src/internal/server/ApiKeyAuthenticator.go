@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Checks requests for a pre-shared API key before passing them on to the wrapped handler
+//
+// The key may be supplied either as `Authorization: Bearer <key>` or as `X-API-Key: <key>`.
+type ApiKeyAuthenticator struct {
+	key []byte
+}
+
+func NewApiKeyAuthenticator(key string) *ApiKeyAuthenticator {
+
+	return &ApiKeyAuthenticator{
+		key: []byte(key),
+	}
+}
+
+// Wrap `next` so that requests without a valid API key receive a 401 response
+func (a *ApiKeyAuthenticator) Middleware(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided := requestApiKey(r)
+
+		// compare in constant time so the key can't be guessed byte-by-byte from response timing
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), a.key) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			msg := "Missing or invalid API key"
+			writeJsonError(w, http.StatusUnauthorized, ERR_UNAUTHORIZED, msg)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// extract the API key from the request headers; returns "" if none was provided
+func requestApiKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, found := strings.Cut(auth, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
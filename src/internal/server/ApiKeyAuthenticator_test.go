@@ -0,0 +1,62 @@
+package server_test
+
+import (
+	"net/http"
+	"src/internal/server"
+	"src/internal/utils"
+	"testing"
+)
+
+func TestApiKeyAuthenticator(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because no key was provided
+		{
+			ReqMethod:          "POST",
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedMessage:    `{"status":"error","message":"Missing or invalid API key","code":"unauthorized"}`,
+		},
+		// should fail because the bearer token is wrong
+		{
+			ReqMethod:          "POST",
+			ReqHeaders:         map[string]string{"Authorization": "Bearer not-the-key"},
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedMessage:    `{"status":"error","message":"Missing or invalid API key","code":"unauthorized"}`,
+		},
+		// should fail because the X-API-Key header is wrong
+		{
+			ReqMethod:          "POST",
+			ReqHeaders:         map[string]string{"X-API-Key": "not-the-key"},
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedMessage:    `{"status":"error","message":"Missing or invalid API key","code":"unauthorized"}`,
+		},
+		// should fail because the authorization scheme isn't Bearer
+		{
+			ReqMethod:          "POST",
+			ReqHeaders:         map[string]string{"Authorization": "Basic s3cret"},
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedMessage:    `{"status":"error","message":"Missing or invalid API key","code":"unauthorized"}`,
+		},
+		// should pass with a bearer token
+		{
+			ReqMethod:          "POST",
+			ReqHeaders:         map[string]string{"Authorization": "Bearer s3cret"},
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    "ok",
+		},
+		// should pass with an X-API-Key header
+		{
+			ReqMethod:          "POST",
+			ReqHeaders:         map[string]string{"X-API-Key": "s3cret"},
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    "ok",
+		},
+	}
+
+	a := server.NewApiKeyAuthenticator("s3cret")
+	handler := a.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	utils.RequestTester(t, testRequests, handler)
+}
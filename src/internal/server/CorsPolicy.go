@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_CORS_ALLOWED_METHODS = "GET, POST"
+	DEFAULT_CORS_ALLOWED_HEADERS = "Authorization, Content-Type, Idempotency-Key, X-API-Key, X-Request-ID"
+	// response headers that browser scripts may read, besides the CORS-safelisted ones
+	CORS_EXPOSED_HEADERS = "Content-Disposition, Idempotent-Replayed, Retry-After, X-Print-Job-Id, X-Request-ID"
+	// how long (in seconds) browsers may cache a preflight response
+	CORS_MAX_AGE = 600
+)
+
+// Adds CORS headers to responses for requests from allowed browser origins, and answers preflight requests
+//
+// Origins must match exactly (scheme, host and port, e.g. `https://labels.example.com`); the single origin `*` allows any origin.
+// Requests from other origins are passed on without CORS headers, so the browser blocks the response.
+type CorsPolicy struct {
+	allowedOrigins map[string]bool
+	allowAny       bool
+	allowedMethods string
+	allowedHeaders string
+}
+
+// Create a CorsPolicy; empty `allowedMethods` or `allowedHeaders` use the defaults
+func NewCorsPolicy(allowedOrigins []string, allowedMethods string, allowedHeaders string) *CorsPolicy {
+	if allowedMethods == "" {
+		allowedMethods = DEFAULT_CORS_ALLOWED_METHODS
+	}
+	if allowedHeaders == "" {
+		allowedHeaders = DEFAULT_CORS_ALLOWED_HEADERS
+	}
+
+	p := &CorsPolicy{
+		allowedOrigins: make(map[string]bool),
+		allowedMethods: allowedMethods,
+		allowedHeaders: allowedHeaders,
+	}
+	for _, o := range allowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			p.allowAny = true
+		} else if o != "" {
+			p.allowedOrigins[o] = true
+		}
+	}
+
+	return p
+}
+
+// Wrap `next` so that responses to allowed origins carry CORS headers; preflight requests are answered with a 204
+func (p *CorsPolicy) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the response depends on the Origin header, so caches must not share it between origins
+		w.Header().Add("Vary", "Origin")
+
+		allowed := p.allowAny || p.allowedOrigins[origin]
+		if allowed {
+			if p.allowAny {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+
+		// preflight requests never reach the handlers, which only accept GET or POST
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", p.allowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", p.allowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(CORS_MAX_AGE))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			w.Header().Set("Access-Control-Expose-Headers", CORS_EXPOSED_HEADERS)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"src/internal/server"
+	"testing"
+)
+
+func TestCorsPolicy(t *testing.T) {
+	called := false
+	cors := server.NewCorsPolicy([]string{"https://labels.example.com", " http://localhost:3000"}, "", "")
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(method string, origin string, preflight bool) *httptest.ResponseRecorder {
+		called = false
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "content-type")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a preflight from an allowed origin is answered without reaching the handler
+	rr := send("OPTIONS", "https://labels.example.com", true)
+	if rr.Code != http.StatusNoContent || called {
+		t.Errorf("preflight: got status %v (handler called: %v), want 204 without calling the handler", rr.Code, called)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://labels.example.com" {
+		t.Errorf("preflight: unexpected Access-Control-Allow-Origin: %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != server.DEFAULT_CORS_ALLOWED_METHODS {
+		t.Errorf("preflight: unexpected Access-Control-Allow-Methods: %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != server.DEFAULT_CORS_ALLOWED_HEADERS {
+		t.Errorf("preflight: unexpected Access-Control-Allow-Headers: %q", got)
+	}
+
+	// a preflight from another origin gets no CORS headers, so the browser blocks the request
+	rr = send("OPTIONS", "https://evil.example.com", true)
+	if rr.Code != http.StatusNoContent || called {
+		t.Errorf("disallowed preflight: got status %v (handler called: %v), want 204 without calling the handler", rr.Code, called)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed preflight: unexpected Access-Control-Allow-Origin: %q", got)
+	}
+
+	// an actual request from an allowed origin reaches the handler with CORS headers
+	rr = send("POST", "http://localhost:3000", false)
+	if rr.Code != http.StatusOK || !called {
+		t.Errorf("allowed origin: got status %v (handler called: %v), want 200", rr.Code, called)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("allowed origin: unexpected Access-Control-Allow-Origin: %q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("allowed origin: unexpected Vary: %q", got)
+	}
+
+	// an actual request from another origin is handled, but without CORS headers
+	rr = send("POST", "https://labels.example.com.evil.com", false)
+	if !called {
+		t.Error("disallowed origin: handler was not called")
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin: unexpected Access-Control-Allow-Origin: %q", got)
+	}
+
+	// same-origin and non-browser requests are untouched
+	rr = send("POST", "", false)
+	if !called || rr.Header().Get("Vary") != "" {
+		t.Errorf("no origin: expected the handler to be called without CORS headers")
+	}
+}
+
+// the single origin "*" should allow any origin
+func TestCorsPolicy_AnyOrigin(t *testing.T) {
+	handler := server.NewCorsPolicy([]string{"*"}, "POST", "Content-Type").Middleware(http.NotFoundHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("unexpected Access-Control-Allow-Origin: %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "POST" {
+		t.Errorf("unexpected Access-Control-Allow-Methods: %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type" {
+		t.Errorf("unexpected Access-Control-Allow-Headers: %q", got)
+	}
+}
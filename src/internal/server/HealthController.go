@@ -1,10 +1,28 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"time"
 )
 
+// a healthy CUPS answers in milliseconds; readiness probes shouldn't wait on one that has hung
+const PRINTER_CHECK_TIMEOUT = 2 * time.Second
+
 type HealthController struct {
+	// must stop when `ctx` ends
+	checkPrinter        func(ctx context.Context) error
+	printerCheckTimeout time.Duration
+	logger              Logger
+}
+
+func NewHealthController(checkPrinter func(ctx context.Context) error, logger Logger) *HealthController {
+
+	return &HealthController{
+		checkPrinter:        checkPrinter,
+		printerCheckTimeout: PRINTER_CHECK_TIMEOUT,
+		logger:              logger,
+	}
 }
 
 func (c *HealthController) CheckHealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -12,10 +30,35 @@ func (c *HealthController) CheckHealthHandler(w http.ResponseWriter, r *http.Req
 	// this endpoing is just an informational endpoint; only allow GET
 	if r.Method != "GET" {
 		msg := "This endpoint only supports GET requests"
-		http.Error(w, msg, http.StatusBadRequest)
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"success","message":"this service is operating as expected"}`))
 }
+
+// Report whether the service is able to print, i.e. whether the printer is reachable and accepting jobs
+func (c *HealthController) CheckReadinessHandler(w http.ResponseWriter, r *http.Request) {
+
+	// this is an informational endpoint; only allow GET
+	if r.Method != "GET" {
+		msg := "This endpoint only supports GET requests"
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.printerCheckTimeout)
+	defer cancel()
+
+	if err := c.checkPrinter(ctx); err != nil {
+		c.logger.Error(r.Context(), "printer check failed", "err", err)
+		writeJsonError(w, http.StatusServiceUnavailable, ERR_PRINTER_UNAVAILABLE, "Printer is unavailable")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"success","message":"the printer is ready"}`))
+}
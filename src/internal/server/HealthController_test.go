@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"src/internal/utils"
 	"testing"
+	"time"
 )
 
 // Validate the functioning of the `/health` endpoint
@@ -14,7 +17,7 @@ func TestCheckHealthHandler(t *testing.T) {
 			ReqMethod:          "POST",
 			ReqBody:            nil,
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "This endpoint only supports GET requests\n",
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports GET requests","code":"method_not_allowed"}`,
 		},
 		// should pass
 		{
@@ -29,3 +32,60 @@ func TestCheckHealthHandler(t *testing.T) {
 
 	utils.RequestTester(t, testRequests, c.CheckHealthHandler)
 }
+
+// Validate the functioning of the `/ready` endpoint with both a healthy and an unavailable printer
+func TestCheckReadinessHandler(t *testing.T) {
+	var readyRequests = []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "POST",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports GET requests","code":"method_not_allowed"}`,
+		},
+		// should pass
+		{
+			ReqMethod:          "GET",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","message":"the printer is ready"}`,
+		},
+	}
+
+	c := NewHealthController(func(ctx context.Context) error { return nil }, NewStdLogger())
+
+	utils.RequestTester(t, readyRequests, c.CheckReadinessHandler)
+
+	var unavailableRequests = []utils.RequestParams{
+		// should fail because the printer is unavailable
+		{
+			ReqMethod:          "GET",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusServiceUnavailable,
+			ExpectedMessage:    `{"status":"error","message":"Printer is unavailable","code":"printer_unavailable"}`,
+		},
+	}
+
+	c = NewHealthController(func(ctx context.Context) error { return errors.New("printer is disabled") }, NewStdLogger())
+
+	utils.RequestTester(t, unavailableRequests, c.CheckReadinessHandler)
+}
+
+// a printer check that hangs should be abandoned after the timeout rather than holding up the probe
+func TestCheckReadinessHandler_Timeout(t *testing.T) {
+	c := NewHealthController(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, NewStdLogger())
+	c.printerCheckTimeout = 10 * time.Millisecond
+
+	utils.RequestTester(t, []utils.RequestParams{
+		// should fail because the printer check timed out
+		{
+			ReqMethod:          "GET",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusServiceUnavailable,
+			ExpectedMessage:    `{"status":"error","message":"Printer is unavailable","code":"printer_unavailable"}`,
+		},
+	}, c.CheckReadinessHandler)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keys longer than this are rejected rather than stored
+const MAX_IDEMPOTENCY_KEY_SIZE = 255
+
+// the only headers copied from a remembered response; the rest (such as X-Request-ID) belong to the request being answered
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "X-Print-Job-Id"}
+
+// Remembers the responses to requests carrying an `Idempotency-Key` header so duplicates can be answered without re-running the handler
+//
+// Entries are evicted least-recently-used once `capacity` is reached, and are forgotten once they are older than `ttl`.
+// Only successful (2xx) responses are remembered; a failed request may be retried with the same key.
+// A key reused with a different body or Accept header is rejected with a 422, rather than answered with a response meant for another request.
+type IdempotencyCache struct {
+	capacity int
+	ttl      time.Duration
+	// bodies are read up to this size to fingerprint them; anything longer is left for the handler to reject
+	maxBodySize int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+}
+
+type idempotentResponse struct {
+	key      string
+	storedAt time.Time
+	// hash of the request body and Accept header that first used the key
+	fingerprint [sha256.Size]byte
+	// closed once the original request has finished and the fields below are populated
+	done chan struct{}
+
+	succeeded  bool
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+func NewIdempotencyCache(capacity int, ttl time.Duration, maxBodySize int) *IdempotencyCache {
+
+	return &IdempotencyCache{
+		capacity:    capacity,
+		ttl:         ttl,
+		maxBodySize: maxBodySize,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// Wrap `next` so that requests repeating a previously successful `Idempotency-Key` receive the original response
+func (c *IdempotencyCache) Middleware(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > MAX_IDEMPOTENCY_KEY_SIZE {
+			msg := "Idempotency-Key header is too long"
+			writeJsonError(w, http.StatusBadRequest, ERR_INVALID_IDEMPOTENCY_KEY, msg)
+			return
+		}
+
+		fingerprint, err := c.fingerprint(r)
+		if err != nil {
+			msg := "Malformed request body"
+			writeJsonError(w, http.StatusBadRequest, ERR_MALFORMED_BODY, msg)
+			return
+		}
+
+		for {
+			entry, isNew := c.claim(key, fingerprint)
+
+			if entry.fingerprint != fingerprint {
+				msg := "Idempotency-Key was already used for a different request"
+				writeJsonError(w, http.StatusUnprocessableEntity, ERR_IDEMPOTENCY_KEY_REUSED, msg)
+				return
+			}
+
+			if isNew {
+				c.run(entry, next, w, r)
+				return
+			}
+
+			// another request with this key is (or was) being handled; wait for its result
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+
+			if entry.succeeded {
+				replay(entry, w)
+				return
+			}
+			// the original request failed and was forgotten; try to claim the key again
+		}
+	}
+}
+
+// find the entry for `key`, or create one if there isn't a live entry; `isNew` reports whether the caller must handle the request
+func (c *IdempotencyCache) claim(key string, fingerprint [sha256.Size]byte) (entry *idempotentResponse, isNew bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if el, ok := c.entries[key]; ok {
+		entry = el.Value.(*idempotentResponse)
+		if now.Sub(entry.storedAt) < c.ttl {
+			c.order.MoveToFront(el)
+			return entry, false
+		}
+		c.remove(el)
+	}
+
+	entry = &idempotentResponse{key: key, storedAt: now, fingerprint: fingerprint, done: make(chan struct{})}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	return entry, true
+}
+
+// handle the request, recording the response on `entry` for any duplicates
+func (c *IdempotencyCache) run(entry *idempotentResponse, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	rec := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+	// waiters must always be released, even if the handler panics
+	defer func() {
+		c.mu.Lock()
+		entry.statusCode = rec.statusCode
+		entry.header = w.Header().Clone()
+		entry.body = rec.body.Bytes()
+		entry.succeeded = rec.statusCode >= 200 && rec.statusCode < 300
+		if !entry.succeeded {
+			if el, ok := c.entries[entry.key]; ok && el.Value == entry {
+				c.remove(el)
+			}
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+
+	next(rec, r)
+}
+
+// hash the request body and Accept header, leaving the body for the handler to read
+func (c *IdempotencyCache) fingerprint(r *http.Request) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(r.Header.Get("Accept") + "\n"))
+
+	if r.Body != nil {
+		// read one byte past the limit so an oversized body still reaches the handler, which rejects it
+		b, err := io.ReadAll(io.LimitReader(r.Body, int64(c.maxBodySize)+1))
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		h.Write(b)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	}
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+func (c *IdempotencyCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*idempotentResponse).key)
+}
+
+// write a previously recorded response to `w`
+func replay(entry *idempotentResponse, w http.ResponseWriter) {
+	for _, k := range replayedHeaders {
+		if v := entry.header.Values(k); len(v) > 0 {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(entry.statusCode)
+	w.Write(entry.body)
+}
+
+// passes writes through to the underlying ResponseWriter while keeping a copy of the status code and body
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(statusCode int) {
+	if !rw.wroteHeader {
+		rw.statusCode = statusCode
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"src/internal/system"
+	"src/internal/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+// repeating an Idempotency-Key should return the original response without printing again
+func TestIdempotencyCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	printCount := 0
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printCount++
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, PrintLeftoverLabelOptions{SpoolDir: t.TempDir(), NewJobId: utils.MockNewJobId, MaxLabelQuantity: 100})
+	cache := NewIdempotencyCache(2, time.Minute, DEFAULT_MAX_REQUEST_BODY_SIZE)
+	cache.now = func() time.Time { return now }
+	handler := cache.Middleware(c.PrintLeftoverLabelHandler)
+
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	const body = `{"labelText":"Lorem ipsum dolor","quantity":2}`
+
+	// the first request prints
+	if rr := send("a", body); rr.Code != http.StatusOK {
+		t.Fatalf("first request failed: %v %v", rr.Code, rr.Body.String())
+	}
+	// the duplicate is answered from the cache
+	rr := send("a", body)
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}` {
+		t.Errorf("duplicate request returned an unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("duplicate request was not marked as replayed")
+	}
+	if printCount != 1 {
+		t.Errorf("duplicate request printed again: printPdf called %v times", printCount)
+	}
+
+	// requests without a key are never deduplicated
+	send("", body)
+	send("", body)
+	if printCount != 3 {
+		t.Errorf("requests without a key should always print: printPdf called %v times, want 3", printCount)
+	}
+
+	// failed requests aren't remembered, so a retry with the same key runs again
+	send("b", `{"labelText":"Lorem ipsum dolor","quantity":100}`)
+	send("b", `{"labelText":"Lorem ipsum dolor","quantity":100}`)
+	if printCount != 5 {
+		t.Errorf("failed requests should not be cached: printPdf called %v times, want 5", printCount)
+	}
+
+	// once the TTL has elapsed the key is forgotten
+	now = now.Add(2 * time.Minute)
+	send("a", body)
+	if printCount != 6 {
+		t.Errorf("expired key should print again: printPdf called %v times, want 6", printCount)
+	}
+
+	// filling the cache past capacity evicts the least recently used key
+	send("c", body)
+	send("d", body)
+	send("a", body)
+	if printCount != 9 {
+		t.Errorf("evicted key should print again: printPdf called %v times, want 9", printCount)
+	}
+}
+
+// a duplicate arriving while the original is still being handled should wait for and share its result
+func TestIdempotencyCache_InFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	var mu sync.Mutex
+	calls := 0
+	cache := NewIdempotencyCache(10, time.Minute, DEFAULT_MAX_REQUEST_BODY_SIZE)
+	handler := cache.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("printed"))
+	})
+
+	// every request looks its key up exactly once before deciding to handle it or wait, and reads the clock to do so
+	claimed := make(chan struct{}, 2)
+	cache.now = func() time.Time {
+		claimed <- struct{}{}
+		return time.Now()
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Idempotency-Key", "same")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+
+	wg.Add(1)
+	go func() { defer wg.Done(); results[0] = send() }()
+	<-claimed
+	<-started
+
+	duplicateDone := make(chan struct{})
+	wg.Add(1)
+	go func() { defer wg.Done(); defer close(duplicateDone); results[1] = send() }()
+
+	// once the duplicate has looked up its key, the original is still running, so it can only wait
+	<-claimed
+	select {
+	case <-duplicateDone:
+		t.Fatal("the duplicate returned while the original was still being handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("handler called %v times, want 1", calls)
+	}
+	for i, rr := range results {
+		if rr.Code != http.StatusOK || rr.Body.String() != "printed" {
+			t.Errorf("request %v returned an unexpected response: %v %v", i, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// a replayed response keeps the current request's correlation ID rather than the original's
+func TestIdempotencyCache_ReplayedHeaders(t *testing.T) {
+	handler := NewIdempotencyCache(10, time.Minute, DEFAULT_MAX_REQUEST_BODY_SIZE).Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("X-Print-Job-Id", "job-1")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("%PDF-"))
+	})
+
+	// the request ID middleware sets the header before the handler runs
+	send := func(requestId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`))
+		req.Header.Set("Idempotency-Key", "same")
+		rr := httptest.NewRecorder()
+		rr.Header().Set("X-Request-ID", requestId)
+		handler(rr, req)
+		return rr
+	}
+
+	send("first")
+	rr := send("second")
+	if got := rr.Header().Get("X-Request-ID"); got != "second" {
+		t.Errorf("replayed response has the request ID %q, want %q", got, "second")
+	}
+	if rr.Header().Get("Content-Type") != "application/pdf" || rr.Header().Get("X-Print-Job-Id") != "job-1" {
+		t.Errorf("replayed response is missing the original's headers: %v", rr.Header())
+	}
+}
+
+// reusing a key for a different request should be rejected rather than answered with the other request's response
+func TestIdempotencyCache_Mismatch(t *testing.T) {
+	calls := 0
+	handler := NewIdempotencyCache(10, time.Minute, DEFAULT_MAX_REQUEST_BODY_SIZE).Middleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("printed"))
+	})
+
+	send := func(body string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		req.Header.Set("Idempotency-Key", "same")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	send(`{"labelText":"Soup","quantity":1}`, "")
+
+	want := `{"status":"error","message":"Idempotency-Key was already used for a different request","code":"idempotency_key_reused"}`
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"different body":   send(`{"labelText":"Stew","quantity":1}`, ""),
+		"different Accept": send(`{"labelText":"Soup","quantity":1}`, "application/pdf"),
+	} {
+		if rr.Code != http.StatusUnprocessableEntity || rr.Body.String() != want {
+			t.Errorf("%v: unexpected response: %v %v", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	// the matching request is still replayed
+	if rr := send(`{"labelText":"Soup","quantity":1}`, ""); rr.Code != http.StatusOK || rr.Body.String() != "printed" {
+		t.Errorf("matching request returned an unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("handler called %v times, want 1", calls)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"src/internal/server/config"
+	"sync"
+	"time"
+)
+
+const DEFAULT_JOB_HISTORY_SIZE = config.DEFAULT_JOB_HISTORY_SIZE
+
+const (
+	JOB_OUTCOME_PRINTED = "printed"
+	JOB_OUTCOME_FAILED  = "failed"
+)
+
+// A print job and how it turned out
+type JobRecord struct {
+	JobId     string    `json:"jobId"`
+	LabelText string    `json:"labelText"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"createdAt"`
+	// `JOB_OUTCOME_PRINTED` or `JOB_OUTCOME_FAILED`
+	Outcome string `json:"outcome"`
+	// the error code returned to the client; only set for failed jobs
+	Code      string `json:"code,omitempty"`
+	CupsJobId string `json:"cupsJobId,omitempty"`
+}
+
+type JobListResponseBody struct {
+	Status string      `json:"status"`
+	Jobs   []JobRecord `json:"jobs"`
+}
+
+// Remembers the most recent print jobs in a fixed-size ring buffer; older jobs are forgotten
+type JobHistory struct {
+	mu      sync.Mutex
+	records []JobRecord
+	next    int // index the next record is written to
+	full    bool
+}
+
+func NewJobHistory(size int) *JobHistory {
+
+	return &JobHistory{
+		records: make([]JobRecord, size),
+	}
+}
+
+// Add a job to the history, replacing the oldest one if the history is full
+func (h *JobHistory) Record(job JobRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.records) == 0 {
+		return
+	}
+
+	h.records[h.next] = job
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Get the remembered jobs, newest first
+func (h *JobHistory) Recent() []JobRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.records)
+	}
+
+	jobs := make([]JobRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		jobs = append(jobs, h.records[(h.next-i+len(h.records))%len(h.records)])
+	}
+
+	return jobs
+}
+
+// List the remembered jobs, newest first
+func (h *JobHistory) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// this is an informational endpoint; only allow GET
+	if r.Method != "GET" {
+		msg := "This endpoint only supports GET requests"
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return
+	}
+
+	b, err := json.Marshal(JobListResponseBody{Status: "success", Jobs: h.Recent()})
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
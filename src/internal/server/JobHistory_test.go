@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"src/internal/server"
+	"src/internal/system"
+	"src/internal/utils"
+	"strconv"
+	"testing"
+)
+
+// printed and failed jobs should be listed newest first, and only the most recent ones kept
+func TestJobHistory(t *testing.T) {
+	history := server.NewJobHistory(3)
+
+	n := 0
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:         t.TempDir(),
+		JobHistory:       history,
+		MaxLabelQuantity: 100,
+		NewJobId: func() string {
+			n++
+			return "job-" + strconv.Itoa(n)
+		},
+	})
+
+	for _, body := range []string{
+		`{"labelText":"Soup","quantity":1}`,
+		`{"labelText":"Chili","quantity":2}`,
+		// fails to print (quantity 100 is the trigger)
+		`{"labelText":"Stew","quantity":100}`,
+		`{"labelText":"Curry","quantity":3}`,
+		// invalid requests never become jobs
+		`{"labelText":"","quantity":1}`,
+	} {
+		c.PrintLeftoverLabelHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewBufferString(body)))
+	}
+
+	rr := httptest.NewRecorder()
+	history.ListJobsHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+
+	var res server.JobListResponseBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	// the first job has been pushed out of the history
+	want := []server.JobRecord{
+		{JobId: "job-4", LabelText: "Curry", Quantity: 3, Outcome: server.JOB_OUTCOME_PRINTED, CupsJobId: "dymo-42"},
+		{JobId: "job-3", LabelText: "Stew", Quantity: 100, Outcome: server.JOB_OUTCOME_FAILED, Code: server.ERR_PRINT_FAILED},
+		{JobId: "job-2", LabelText: "Chili", Quantity: 2, Outcome: server.JOB_OUTCOME_PRINTED, CupsJobId: "dymo-42"},
+	}
+	if res.Status != "success" || len(res.Jobs) != len(want) {
+		t.Fatalf("unexpected job list: %v", rr.Body.String())
+	}
+	for i, job := range res.Jobs {
+		if job.CreatedAt.IsZero() {
+			t.Errorf("job %v has no timestamp", job.JobId)
+		}
+		job.CreatedAt = want[i].CreatedAt
+		if job != want[i] {
+			t.Errorf("unexpected job at position %v:\ngot:  %+v\nwant: %+v", i, job, want[i])
+		}
+	}
+}
+
+// test pages are print jobs too, and should be listed alongside labels
+func TestJobHistory_TestPage(t *testing.T) {
+	history := server.NewJobHistory(10)
+
+	fail := false
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		if fail {
+			return nil, errors.New("printer on fire")
+		}
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:   t.TempDir(),
+		JobHistory: history,
+		NewJobId:   utils.MockNewJobId,
+	})
+
+	c.PrintTestPageHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	fail = true
+	c.PrintTestPageHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	want := []server.JobRecord{
+		{JobId: "test-job", LabelText: server.TEST_PAGE_LABEL_TEXT, Quantity: 1, Outcome: server.JOB_OUTCOME_FAILED, Code: server.ERR_PRINT_FAILED},
+		{JobId: "test-job", LabelText: server.TEST_PAGE_LABEL_TEXT, Quantity: 1, Outcome: server.JOB_OUTCOME_PRINTED, CupsJobId: "dymo-42"},
+	}
+	jobs := history.Recent()
+	if len(jobs) != len(want) {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	for i, job := range jobs {
+		job.CreatedAt = want[i].CreatedAt
+		if job != want[i] {
+			t.Errorf("unexpected job at position %v:\ngot:  %+v\nwant: %+v", i, job, want[i])
+		}
+	}
+}
+
+func TestJobHistory_Empty(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "POST",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports GET requests","code":"method_not_allowed"}`,
+		},
+		// should pass with an empty list rather than null
+		{
+			ReqMethod:          "GET",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobs":[]}`,
+		},
+	}
+
+	utils.RequestTester(t, testRequests, server.NewJobHistory(10).ListJobsHandler)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Leveled, structured logger used by the controllers
+//
+// `keysAndValues` are alternating keys and values, e.g. `logger.Error(ctx, "print failed", "file", name, "err", err)`.
+// Implementations should include the request ID from `ctx` (see `RequestIdFromContext`) when there is one.
+type Logger interface {
+	Info(ctx context.Context, msg string, keysAndValues ...any)
+	Warn(ctx context.Context, msg string, keysAndValues ...any)
+	Error(ctx context.Context, msg string, keysAndValues ...any)
+}
+
+// Logger that writes logfmt-style lines (`level=ERROR msg="..." key=value`) through the standard library logger
+type StdLogger struct {
+	logger *log.Logger
+}
+
+// Create a Logger that writes to the standard library's default logger
+func NewStdLogger() *StdLogger {
+
+	return &StdLogger{
+		logger: log.Default(),
+	}
+}
+
+func (l *StdLogger) Info(ctx context.Context, msg string, keysAndValues ...any) {
+	l.log(ctx, "INFO", msg, keysAndValues)
+}
+
+func (l *StdLogger) Warn(ctx context.Context, msg string, keysAndValues ...any) {
+	l.log(ctx, "WARN", msg, keysAndValues)
+}
+
+func (l *StdLogger) Error(ctx context.Context, msg string, keysAndValues ...any) {
+	l.log(ctx, "ERROR", msg, keysAndValues)
+}
+
+func (l *StdLogger) log(ctx context.Context, level string, msg string, keysAndValues []any) {
+	var b strings.Builder
+	b.WriteString("level=" + level + " msg=" + logfmtValue(msg))
+
+	if id := RequestIdFromContext(ctx); id != "" {
+		b.WriteString(" request_id=" + logfmtValue(id))
+	}
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		val := "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			val = fmt.Sprint(keysAndValues[i+1])
+		}
+		b.WriteString(" " + key + "=" + logfmtValue(val))
+	}
+
+	l.logger.Println(b.String())
+}
+
+// quote values containing spaces, quotes or anything unprintable (control characters, DEL, line and paragraph separators)
+// so each line stays parseable and label text can't forge log lines
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\\") || strings.IndexFunc(v, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+)
+
+// log lines should be logfmt-style, quoting values where necessary and including the request ID
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &StdLogger{logger: log.New(&buf, "", 0)}
+
+	ctx := context.WithValue(context.Background(), requestIdKey{}, "abc-123")
+	l.Error(ctx, "unable to print label", "stage", "print", "quantity", 2, "err", errors.New("exit status 1"))
+
+	want := `level=ERROR msg="unable to print label" request_id=abc-123 stage=print quantity=2 err="exit status 1"` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected log line:\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	l.Info(context.Background(), "label printed", "output", "request id is dymo-1\n", "dangling")
+
+	want = `level=INFO msg="label printed" output="request id is dymo-1\n" dangling=(MISSING)` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected log line:\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+
+	// unprintable characters beyond ASCII control characters could break the line in some viewers, forging an entry
+	buf.Reset()
+	l.Warn(context.Background(), "label text", "text", "Soup\u2028forged", "del", "a\x7fb", "nbsp", "a\u00a0b")
+
+	want = `level=WARN msg="label text" text="Soup\u2028forged" del="a\x7fb" nbsp="a\u00a0b"` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected log line:\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+}
@@ -1,25 +1,181 @@
 package server
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"src/internal/buildinfo"
+	"src/internal/pdf"
+	"src/internal/server/config"
+	"src/internal/system"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type PrintLeftoverLabelController struct {
-	generatePdf func(labelText string, dateDescriptor string) ([]byte, error)
-	printPdf    func(quantity int, filePathName string) ([]byte, error)
+	generatePdf func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error)
+	// serializes submissions to each printer; PDFs are still generated concurrently
+	printQueue            *PrintQueue
+	defaultDateDescriptor string
+	labelOptions          pdf.Options
+	spoolDir              string
+	printerName           string
+	// printers a request may choose instead of the default; always includes the default
+	allowedPrinters    map[string]bool
+	maxRequestBodySize int
+	maxLabelTextLength int
+	maxLabelQuantity   int
+	logger             Logger
+	// holds one token per print in progress; a full channel means the printer is busy
+	printSlots        chan struct{}
+	printQueueTimeout time.Duration
+	printTimeout      time.Duration
+	writeTimeout      time.Duration
+	cutBetweenCopies  bool
+	newJobId          func() string
+	jobHistory        *JobHistory
 }
 
-func NewPrintLeftoverLabelController(generatePdf func(lt string, dd string) ([]byte, error), printPdf func(q int, fpn string) ([]byte, error)) *PrintLeftoverLabelController {
+// Deployment-specific settings for the print controller; the zero value uses the built-in defaults
+type PrintLeftoverLabelOptions struct {
+	// used when a request doesn't provide a dateDescriptor; defaults to `pdf.DEFAULT_DATE_DESCRIPTOR`
+	DefaultDateDescriptor string
+	// base settings for every label (e.g. date layout and timezone); request-specific settings are applied on top
+	LabelOptions pdf.Options
+	// directory in which generated PDFs are saved before printing; defaults to `DEFAULT_SPOOL_DIR`
+	SpoolDir string
+	// the CUPS printer labels are sent to; defaults to `DEFAULT_PRINTER_NAME`
+	PrinterName string
+	// further CUPS printers a request may send its label to with `printerName`
+	AllowedPrinters []string
+	// maximum size of a request body in bytes; defaults to `DEFAULT_MAX_REQUEST_BODY_SIZE`
+	MaxRequestBodySize int
+	// maximum number of characters (runes) in labelText; defaults to `DEFAULT_MAX_LABEL_TEXT_LENGTH`
+	MaxLabelTextLength int
+	// maximum number of copies of a label printed per request; defaults to `DEFAULT_MAX_LABEL_QUANTITY`
+	MaxLabelQuantity int
+	// defaults to a `StdLogger`
+	Logger Logger
+	// maximum number of print requests handled at the same time; defaults to `DEFAULT_MAX_CONCURRENT_PRINTS`
+	MaxConcurrentPrints int
+	// how long a request waits for a print slot before giving up with a 503; defaults to `DEFAULT_PRINT_QUEUE_TIMEOUT`
+	PrintQueueTimeout time.Duration
+	// maximum number of jobs waiting for each printer; further jobs fail with a 503. Defaults to `DEFAULT_PRINT_QUEUE_SIZE`
+	PrintQueueSize int
+	// how long each print command may run before it is killed and the request fails with a 504; defaults to `DEFAULT_PRINT_TIMEOUT`.
+	// With `CutBetweenCopies` every copy is a print command of its own
+	PrintTimeout time.Duration
+	// the server's write timeout; print jobs are abandoned `WRITE_TIMEOUT_MARGIN` before it, so the client still gets a response.
+	// Zero leaves jobs unlimited apart from `PrintTimeout`
+	WriteTimeout time.Duration
+	// print each copy as a separate job so the printer cuts (or feeds) between copies; off by default
+	CutBetweenCopies bool
+	// generates the ID returned to the client for each print job; defaults to random UUIDs
+	NewJobId func() string
+	// records every print job; defaults to a history of `DEFAULT_JOB_HISTORY_SIZE` jobs
+	JobHistory *JobHistory
+}
+
+func NewPrintLeftoverLabelController(generatePdf func(lt string, dd string, o pdf.Options) ([]byte, error), printPdf func(ctx context.Context, job system.PrintJob) ([]byte, error), opts PrintLeftoverLabelOptions) *PrintLeftoverLabelController {
+
+	dd := opts.DefaultDateDescriptor
+	if dd == "" {
+		dd = pdf.DEFAULT_DATE_DESCRIPTOR
+	}
+
+	spoolDir := opts.SpoolDir
+	if spoolDir == "" {
+		spoolDir = DEFAULT_SPOOL_DIR
+	}
+
+	printerName := opts.PrinterName
+	if printerName == "" {
+		printerName = DEFAULT_PRINTER_NAME
+	}
+
+	allowedPrinters := map[string]bool{printerName: true}
+	for _, p := range opts.AllowedPrinters {
+		allowedPrinters[p] = true
+	}
+
+	maxRequestBodySize := opts.MaxRequestBodySize
+	if maxRequestBodySize <= 0 {
+		maxRequestBodySize = DEFAULT_MAX_REQUEST_BODY_SIZE
+	}
+
+	maxLabelTextLength := opts.MaxLabelTextLength
+	if maxLabelTextLength <= 0 {
+		maxLabelTextLength = DEFAULT_MAX_LABEL_TEXT_LENGTH
+	}
+
+	maxLabelQuantity := opts.MaxLabelQuantity
+	if maxLabelQuantity <= 0 {
+		maxLabelQuantity = DEFAULT_MAX_LABEL_QUANTITY
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = NewStdLogger()
+	}
+
+	maxConcurrentPrints := opts.MaxConcurrentPrints
+	if maxConcurrentPrints <= 0 {
+		maxConcurrentPrints = DEFAULT_MAX_CONCURRENT_PRINTS
+	}
+
+	printQueueTimeout := opts.PrintQueueTimeout
+	if printQueueTimeout <= 0 {
+		printQueueTimeout = DEFAULT_PRINT_QUEUE_TIMEOUT
+	}
+
+	printQueueSize := opts.PrintQueueSize
+	if printQueueSize <= 0 {
+		printQueueSize = DEFAULT_PRINT_QUEUE_SIZE
+	}
+
+	printTimeout := opts.PrintTimeout
+	if printTimeout <= 0 {
+		printTimeout = DEFAULT_PRINT_TIMEOUT
+	}
+
+	newJobId := opts.NewJobId
+	if newJobId == nil {
+		newJobId = newRequestId
+	}
+
+	jobHistory := opts.JobHistory
+	if jobHistory == nil {
+		jobHistory = NewJobHistory(DEFAULT_JOB_HISTORY_SIZE)
+	}
 
 	return &PrintLeftoverLabelController{
-		generatePdf: generatePdf,
-		printPdf:    printPdf,
+		generatePdf:           generatePdf,
+		printQueue:            NewPrintQueue(printPdf, printQueueSize),
+		defaultDateDescriptor: dd,
+		labelOptions:          opts.LabelOptions,
+		spoolDir:              spoolDir,
+		printerName:           printerName,
+		allowedPrinters:       allowedPrinters,
+		maxRequestBodySize:    maxRequestBodySize,
+		maxLabelTextLength:    maxLabelTextLength,
+		maxLabelQuantity:      maxLabelQuantity,
+		logger:                logger,
+		printSlots:            make(chan struct{}, maxConcurrentPrints),
+		printQueueTimeout:     printQueueTimeout,
+		printTimeout:          printTimeout,
+		writeTimeout:          opts.WriteTimeout,
+		cutBetweenCopies:      opts.CutBetweenCopies,
+		newJobId:              newJobId,
+		jobHistory:            jobHistory,
 	}
 }
 
@@ -27,22 +183,73 @@ type PrintLabelRequestBody struct {
 	LabelText      string `json:"labelText"`
 	Quantity       int    `json:"quantity"`
 	DateDescriptor string `json:"dateDescriptor"`
+	ShelfLifeDays  *int   `json:"shelfLifeDays"`
+	// CUPS options such as `media`; only the keys allowed by `system.ValidatePrintOptions` are accepted
+	Options map[string]string `json:"options"`
+	// one of the configured printers; defaults to the deployment's printer
+	PrinterName string `json:"printerName"`
+	// `landscape` (the default) or `portrait`
+	Orientation string `json:"orientation"`
+	// hex colors such as `#1e90ff` (or `#19f`), for contrast on colored label stock; default to the standard label colors
+	TitleColor string `json:"titleColor"`
+	DateColor  string `json:"dateColor"`
+
+	// the colors above, parsed
+	style pdf.Style
+}
+
+// Describes a successfully printed label
+type PrintLabelResponseBody struct {
+	Status string `json:"status"`
+	// generated by the server for each print, so clients can refer to the job
+	JobId string `json:"jobId"`
+	// the ID CUPS assigned to the job; omitted if the print command didn't report one
+	CupsJobId string `json:"cupsJobId,omitempty"`
+	Printer   string `json:"printer"`
+	Copies    int    `json:"copies"`
 }
 
-const FILE_PATH = "./tmp"
+// defaults for settings left unset in `PrintLeftoverLabelOptions`; the config package explains how they were chosen
+const (
+	DEFAULT_SPOOL_DIR             = config.DEFAULT_SPOOL_DIR
+	DEFAULT_PRINTER_NAME          = system.DEFAULT_PRINTER_NAME
+	DEFAULT_MAX_REQUEST_BODY_SIZE = config.DEFAULT_MAX_REQUEST_BODY_SIZE
+	DEFAULT_MAX_LABEL_TEXT_LENGTH = config.DEFAULT_MAX_LABEL_TEXT_LENGTH
+	DEFAULT_MAX_LABEL_QUANTITY    = config.DEFAULT_MAX_LABEL_QUANTITY
+	DEFAULT_MAX_CONCURRENT_PRINTS = config.DEFAULT_MAX_CONCURRENT_PRINTS
+	DEFAULT_PRINT_QUEUE_TIMEOUT   = config.DEFAULT_PRINT_QUEUE_TIMEOUT
+	DEFAULT_PRINT_TIMEOUT         = config.DEFAULT_PRINT_TIMEOUT
+)
 
-// the label itself can only display a few words, so 128 bytes is more than enough for a reasonable request
-// yet it is small enough to very quickly recognize if the request is unreasonably large
-const MAX_REQUEST_BODY_SIZE = 128
-const MAX_DATE_DESCRIPTOR_SIZE = 20
+const WRITE_TIMEOUT_MARGIN = config.WRITE_TIMEOUT_MARGIN
 
-func (c *PrintLeftoverLabelController) PrintLeftoverLabelHandler(w http.ResponseWriter, r *http.Request) {
+const MAX_DATE_DESCRIPTOR_LENGTH = config.MAX_DATE_DESCRIPTOR_LENGTH
+
+// spooled PDFs are named after this pattern, with the "*" replaced by a random string
+const SPOOL_FILE_PATTERN = "label-*.pdf"
+
+// the IPP value for portrait printing; landscape labels rely on the print command's default rotation instead
+const PORTRAIT_ORIENTATION_REQUESTED = "3"
+
+// nobody should be keeping leftovers for more than a year
+const MAX_SHELF_LIFE_DAYS = 365
+
+// the test page shows the time to the minute, so consecutive test prints can be told apart
+const (
+	TEST_PAGE_LABEL_TEXT  = "Test page"
+	TEST_PAGE_DATE_LAYOUT = "2006-01-02 15:04"
+)
+
+// Validate the request and decode its body
+//
+// On failure an error response has already been written and `ok` is false; the caller should simply return.
+func (c *PrintLeftoverLabelController) parseRequest(w http.ResponseWriter, r *http.Request) (rb PrintLabelRequestBody, ok bool) {
 	/* -- FAIL FAST -- */
 
 	if r.Method != "POST" {
 		msg := "This endpoint only supports POST requests"
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return rb, false
 	}
 
 	// ensure Content-Type "application/json"
@@ -51,27 +258,34 @@ func (c *PrintLeftoverLabelController) PrintLeftoverLabelHandler(w http.Response
 		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
 		if mediaType != "application/json" {
 			msg := "Content-Type header is not application/json. Received: " + mediaType
-			http.Error(w, msg, http.StatusUnsupportedMediaType)
-			return
+			writeJsonError(w, http.StatusUnsupportedMediaType, ERR_UNSUPPORTED_MEDIA_TYPE, msg)
+			return rb, false
 		}
 	}
 
 	if r.Body == nil {
 		msg := "Request body not provided"
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		writeJsonError(w, http.StatusBadRequest, ERR_MISSING_BODY, msg)
+		return rb, false
 	}
 
 	/* -- PARSE AND VALIDATE BODY -- */
 
 	// limit the amount of data to be read from the body
 	// this protects against hanging the app if we get an unreasonably large request body
-	r.Body = http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY_SIZE)
-
-	rb := PrintLabelRequestBody{}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(c.maxRequestBodySize))
 
-	dec := json.NewDecoder(r.Body)
 	defer r.Body.Close()
+
+	// clients rarely send a nil body; catch an empty one here, as the decoder would only call it malformed
+	body := bufio.NewReader(r.Body)
+	if _, err := body.Peek(1); err == io.EOF {
+		msg := "Request body is empty"
+		writeJsonError(w, http.StatusBadRequest, ERR_MISSING_BODY, msg)
+		return rb, false
+	}
+
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(&rb)
@@ -79,92 +293,463 @@ func (c *PrintLeftoverLabelController) PrintLeftoverLabelHandler(w http.Response
 		switch {
 		case err.Error() == "http: request body too large":
 			msg := "Request body is too large"
-			http.Error(w, msg, http.StatusRequestEntityTooLarge)
-			return
+			writeJsonError(w, http.StatusRequestEntityTooLarge, ERR_BODY_TOO_LARGE, msg)
+			return rb, false
 		case strings.Contains(err.Error(), `json: unknown field`):
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			writeJsonError(w, http.StatusBadRequest, ERR_UNKNOWN_FIELD, err.Error())
+			return rb, false
 		default:
 			msg := "Malformed request body"
-			http.Error(w, msg, http.StatusBadRequest)
-			return
+			writeJsonError(w, http.StatusBadRequest, ERR_MALFORMED_BODY, msg)
+			return rb, false
 		}
 	}
 
 	// ensure the data collected from the client passes a "stink check"
+	// every field is checked so a form can highlight all of its mistakes at once
+	var errs []FieldError
+	invalid := func(field string, code string, msg string) {
+		errs = append(errs, FieldError{Field: field, Message: msg, Code: code})
+	}
+
+	// surrounding whitespace would only push the text off-center, so drop it
+	rb.LabelText = strings.TrimSpace(rb.LabelText)
+	rb.DateDescriptor = strings.TrimSpace(rb.DateDescriptor)
 	if rb.LabelText == "" {
-		msg := "no value provided for labelText"
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		invalid("labelText", ERR_MISSING_LABEL_TEXT, "no value provided for labelText")
+	} else if !pdf.IsPrintable(rb.LabelText) {
+		invalid("labelText", ERR_INVALID_CHARACTERS, "value for labelText contains characters that can't be printed, such as line breaks or tabs")
+	} else if utf8.RuneCountInString(rb.LabelText) > c.maxLabelTextLength {
+		// count runes rather than bytes so accented characters aren't penalized
+		invalid("labelText", ERR_LABEL_TEXT_TOO_LONG, "value for labelText has too many characters: try something shorter")
+	} else if missing := unsupportedCharacters(pdf.ValidateLabelText(rb.LabelText, c.labelOptions.Fonts)); missing != "" {
+		// caught here rather than by generatePdf, so the request never takes a print slot or becomes a job
+		invalid("labelText", ERR_UNSUPPORTED_CHARACTERS, "value for labelText contains characters the label font can't print: "+missing)
 	}
 	if rb.Quantity <= 0 {
-		msg := "invalid quantity: value must be a positive integer"
-		http.Error(w, msg, http.StatusBadRequest)
+		invalid("quantity", ERR_INVALID_QUANTITY, "invalid quantity: value must be a positive integer")
+	} else if rb.Quantity > c.maxLabelQuantity {
+		// one request shouldn't be able to monopolize the printer
+		invalid("quantity", ERR_QUANTITY_TOO_LARGE, fmt.Sprintf("invalid quantity: no more than %v labels can be printed at once", c.maxLabelQuantity))
+	}
+	// this is an optional parameter; if unset, the deployment's configured default is used
+	if rb.DateDescriptor == "" {
+		rb.DateDescriptor = c.defaultDateDescriptor
+	}
+	if !pdf.IsPrintable(rb.DateDescriptor) {
+		invalid("dateDescriptor", ERR_INVALID_CHARACTERS, "value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs")
+	} else if utf8.RuneCountInString(rb.DateDescriptor) > MAX_DATE_DESCRIPTOR_LENGTH {
+		invalid("dateDescriptor", ERR_DATE_DESCRIPTOR_TOO_LONG, "value for dateDescriptor has too many characters: try something shorter")
+	} else if missing := unsupportedCharacters(pdf.ValidateDateDescriptor(rb.DateDescriptor, c.labelOptions.Fonts)); missing != "" {
+		invalid("dateDescriptor", ERR_UNSUPPORTED_CHARACTERS, "value for dateDescriptor contains characters the label font can't print: "+missing)
+	}
+	// this is an optional parameter; if set, a "use by" date is added to the label
+	if rb.ShelfLifeDays != nil && (*rb.ShelfLifeDays < 0 || *rb.ShelfLifeDays > MAX_SHELF_LIFE_DAYS) {
+		invalid("shelfLifeDays", ERR_INVALID_SHELF_LIFE, fmt.Sprintf("invalid shelfLifeDays: value must be an integer between 0 and %v", MAX_SHELF_LIFE_DAYS))
+	}
+	// this is an optional parameter; if set, the options are passed on to the print command
+	if err := system.ValidatePrintOptions(rb.Options); err != nil {
+		invalid("options", ERR_INVALID_PRINT_OPTION, err.Error())
+	}
+	// this is an optional parameter; if unset, the label is landscape
+	if err := pdf.ValidateOrientation(rb.Orientation); err != nil {
+		invalid("orientation", ERR_INVALID_ORIENTATION, err.Error())
+	} else if rb.Orientation == pdf.ORIENTATION_PORTRAIT && rb.Options["orientation-requested"] == "" {
+		// a portrait page already matches the label roll, so CUPS mustn't rotate it like a landscape one
+		options := map[string]string{"orientation-requested": PORTRAIT_ORIENTATION_REQUESTED}
+		for k, v := range rb.Options {
+			options[k] = v
+		}
+		rb.Options = options
+	}
+	// these are optional parameters; if unset, the standard label colors are used
+	if rb.TitleColor != "" {
+		if color, err := parseHexColor(rb.TitleColor); err != nil {
+			invalid("titleColor", ERR_INVALID_COLOR, "value for titleColor "+err.Error())
+		} else {
+			rb.style.TitleColor = &color
+		}
+	}
+	if rb.DateColor != "" {
+		if color, err := parseHexColor(rb.DateColor); err != nil {
+			invalid("dateColor", ERR_INVALID_COLOR, "value for dateColor "+err.Error())
+		} else {
+			rb.style.DateColor = &color
+		}
+	}
+	// this is an optional parameter; if unset, the deployment's printer is used
+	if rb.PrinterName == "" {
+		rb.PrinterName = c.printerName
+	} else if !c.allowedPrinters[rb.PrinterName] {
+		invalid("printerName", ERR_UNKNOWN_PRINTER, "value for printerName is not one of the configured printers")
+	}
+
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return rb, false
+	}
+
+	return rb, true
+}
+
+// parse a CSS-style hex color: `#rrggbb` or the shorthand `#rgb`
+func parseHexColor(s string) (pdf.Color, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || (len(hex) != 3 && len(hex) != 6) {
+		return pdf.Color{}, errors.New("must be a hex color like #1e90ff")
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return pdf.Color{}, errors.New("must be a hex color like #1e90ff")
+	}
+
+	return pdf.Color{R: int(v >> 16 & 0xff), G: int(v >> 8 & 0xff), B: int(v & 0xff)}, nil
+}
+
+// list the characters a font check found no glyphs for, e.g. "'🍲', '✓'"; empty if `err` isn't about missing glyphs.
+// Other failures mean the deployment's fonts are broken, which PDF generation reports as a server error
+func unsupportedCharacters(err error) string {
+	var unsupported *pdf.UnsupportedCharactersError
+	if !errors.As(err, &unsupported) {
+		return ""
+	}
+
+	quoted := make([]string, len(unsupported.Characters))
+	for i, r := range unsupported.Characters {
+		quoted[i] = fmt.Sprintf("%q", r)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func (c *PrintLeftoverLabelController) PrintLeftoverLabelHandler(w http.ResponseWriter, r *http.Request) {
+	rb, ok := c.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	job := c.newJobRecord(rb)
+	defer func() { c.jobHistory.Record(job) }()
+
+	printed, code := c.printLabel(w, r, rb, c.labelOptionsFor(rb))
+	if code != "" {
+		job.Code = code
+		return
+	}
+
+	res := PrintLabelResponseBody{
+		Status:    "success",
+		JobId:     job.JobId,
+		CupsJobId: system.ParseCupsJobId(printed.output),
+		Printer:   rb.PrinterName,
+		Copies:    rb.Quantity,
+	}
+	job.Outcome, job.CupsJobId = JOB_OUTCOME_PRINTED, res.CupsJobId
+	c.logger.Info(r.Context(), "label printed", "job_id", res.JobId, "cups_job_id", res.CupsJobId, "file", printed.filePathName, "quantity", rb.Quantity, "output", string(printed.output))
+
+	// clients asking for the PDF get the printed document back; the job ID is still available in a header
+	if prefersPdf(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="label-%v.pdf"`, res.JobId))
+		w.Header().Set("X-Print-Job-Id", res.JobId)
+		w.WriteHeader(http.StatusOK)
+		w.Write(printed.pdf)
 		return
 	}
-	// this is an optional parameter; if unset, the default is "made:"
-	if len(rb.DateDescriptor) > MAX_DATE_DESCRIPTOR_SIZE {
-		msg := "value for dateDescriptor has too many characters: try something shorter"
-		http.Error(w, msg, http.StatusBadRequest)
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// the outcome of a successful `printLabel`
+type printedLabel struct {
+	pdf          []byte
+	output       []byte
+	filePathName string
+}
+
+// Generate the label, save it to the spool directory and send it to the printer
+//
+// On failure an error response has already been written and `code` is the error code sent to the client; it is empty on success.
+func (c *PrintLeftoverLabelController) printLabel(w http.ResponseWriter, r *http.Request, rb PrintLabelRequestBody, opts pdf.Options) (printed printedLabel, code string) {
+	fail := func(statusCode int, errCode string, msg string) (printedLabel, string) {
+		writeJsonError(w, statusCode, errCode, msg)
+		return printedLabel{}, errCode
+	}
+	start := time.Now()
+
+	// wait briefly for a free print slot rather than piling more jobs onto the printer
+	if !c.acquirePrintSlot(r) {
+		w.Header().Set("Retry-After", "1")
+		msg := "The printer is busy: try again shortly"
+		return fail(http.StatusServiceUnavailable, ERR_PRINTER_BUSY, msg)
+	}
+	defer c.releasePrintSlot()
+
 	/* -- GENERATE PDF -- */
 
 	// ensure the directory to save the PDF to exists
-	absPath, err := filepath.Abs(FILE_PATH)
+	absPath, err := filepath.Abs(c.spoolDir)
 	if err != nil {
-		fmt.Println("filepath.Abs error", FILE_PATH)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
+		c.logger.Error(r.Context(), "unable to resolve spool directory", "stage", "spool_prepare", "dir", c.spoolDir, "err", err)
+		return fail(http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
 	}
 
 	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(FILE_PATH, os.ModePerm); err != nil {
-			fmt.Println("failed while trying to make new path:", FILE_PATH)
-			http.Error(w, "", http.StatusInternalServerError)
-			return
+		if err := os.MkdirAll(absPath, 0700); err != nil {
+			c.logger.Error(r.Context(), "unable to create spool directory", "stage", "spool_prepare", "dir", absPath, "err", err)
+			return fail(http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
 		}
 	}
 
-	// use current UTC microsecond time to avoid file naming collisions
-	timeStamp := time.Now().UTC().UnixMicro()
-	fileName := fmt.Sprintf("%v.pdf", timeStamp)
-	filePathName := filepath.Join(absPath, fileName)
-
 	// create file in which we will write the pdf document []byte
-	f, err := os.Create(filePathName)
+	// the random name keeps concurrent requests from overwriting each other's labels, and as labels may be personal,
+	// CreateTemp makes the file readable by the server's user (and CUPS, which runs as root) only
+	f, err := os.CreateTemp(absPath, SPOOL_FILE_PATTERN)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
+		c.logger.Error(r.Context(), "unable to create spool file", "stage", "spool_create", "file", filepath.Join(absPath, SPOOL_FILE_PATTERN), "err", err)
+		return fail(http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
 	}
+	filePathName := f.Name()
+
+	// CUPS keeps its own copy of the document once the print command has run, so the spool file is only needed until then
+	defer os.Remove(filePathName)
 	defer f.Close()
 
 	// generate pdf document as []byte
-	p, err := c.generatePdf(rb.LabelText, rb.DateDescriptor)
+	p, err := c.generatePdf(rb.LabelText, rb.DateDescriptor, opts)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Error preparing label for printing", http.StatusInternalServerError)
-		return
+		return printedLabel{}, c.writePdfGenerationError(w, r, err, "Error preparing label for printing")
 	}
 
 	// write PDF data to file
 	if n, err := f.Write(p); err != nil || n == 0 {
-		fmt.Println(err)
-		http.Error(w, "Error preparing label for printing", http.StatusInternalServerError)
+		c.logger.Error(r.Context(), "unable to write spool file", "stage", "spool_write", "file", filePathName, "bytes", n, "err", err)
+		return fail(http.StatusInternalServerError, ERR_PDF_GENERATION_FAILED, "Error preparing label for printing")
+	}
+
+	// each print command is killed if it hangs, and the whole job if the client goes away. The job as a whole, including the
+	// time spent queued for the printer, gets one print timeout per command, but has to end before the write timeout does
+	jobTimeout := c.printTimeout
+	if c.cutBetweenCopies {
+		jobTimeout *= time.Duration(rb.Quantity)
+	}
+	if c.writeTimeout > 0 {
+		if remaining := c.writeTimeout - WRITE_TIMEOUT_MARGIN - time.Since(start); remaining < jobTimeout {
+			jobTimeout = remaining
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), jobTimeout)
+	defer cancel()
+
+	out, err := c.printQueue.Submit(ctx, system.PrintJob{FilePathName: filePathName, Quantity: rb.Quantity, Printer: rb.PrinterName, Options: rb.Options, CutBetweenCopies: c.cutBetweenCopies, CopyTimeout: c.printTimeout})
+	if err != nil {
+		c.logger.Error(r.Context(), "unable to print label", "stage", "print", "file", filePathName, "quantity", rb.Quantity, "output", string(out), "err", err)
+		if errors.Is(err, ErrPrintQueueFull) {
+			w.Header().Set("Retry-After", "1")
+			msg := "The print queue is full: try again shortly"
+			return fail(http.StatusServiceUnavailable, ERR_PRINTER_BUSY, msg)
+		}
+		// if some copies made it to the printer, say so; retrying the whole job would print them twice
+		var partial *system.PartialPrintError
+		suffix := ""
+		if errors.As(err, &partial) {
+			suffix = fmt.Sprintf(" after %v of %v labels were printed", partial.Printed, partial.Total)
+		}
+		// either a single print command or the job as a whole ran out of time
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fail(http.StatusGatewayTimeout, ERR_PRINT_TIMEOUT, "Timed out waiting for the printer"+suffix)
+		}
+		return fail(http.StatusInternalServerError, ERR_PRINT_FAILED, "Error printing label"+suffix)
+	}
+
+	return printedLabel{pdf: p, output: out, filePathName: filePathName}, ""
+}
+
+// Generate the label described by the request and return the PDF document without printing it
+func (c *PrintLeftoverLabelController) PreviewLeftoverLabelHandler(w http.ResponseWriter, r *http.Request) {
+	rb, ok := c.parseRequest(w, r)
+	if !ok {
 		return
 	}
 
-	out, err := c.printPdf(rb.Quantity, filePathName)
+	p, err := c.generatePdf(rb.LabelText, rb.DateDescriptor, c.labelOptionsFor(rb))
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Error printing label", http.StatusInternalServerError)
+		c.writePdfGenerationError(w, r, err, "Error preparing label preview")
 		return
 	}
-	fmt.Println("function output: ", string(out))
 
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="label-preview.pdf"`)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"success"}`))
-	return
+	w.Write(p)
+}
+
+// Print a fixed diagnostic label showing the printer name, the current time and the server version
+//
+// Installers use this to check the printer works end-to-end through the HTTP path; no request body is needed.
+func (c *PrintLeftoverLabelController) PrintTestPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		msg := "This endpoint only supports POST requests"
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return
+	}
+
+	rb := PrintLabelRequestBody{
+		LabelText:      TEST_PAGE_LABEL_TEXT,
+		DateDescriptor: c.testPageDateDescriptor(),
+		Quantity:       1,
+		PrinterName:    c.printerName,
+	}
+	opts := c.labelOptions
+	opts.DateLayout = TEST_PAGE_DATE_LAYOUT
+	opts.Date = time.Now()
+
+	job := c.newJobRecord(rb)
+	defer func() { c.jobHistory.Record(job) }()
+
+	printed, code := c.printLabel(w, r, rb, opts)
+	if code != "" {
+		job.Code = code
+		return
+	}
+
+	res := PrintLabelResponseBody{
+		Status:    "success",
+		JobId:     job.JobId,
+		CupsJobId: system.ParseCupsJobId(printed.output),
+		Printer:   c.printerName,
+		Copies:    rb.Quantity,
+	}
+	job.Outcome, job.CupsJobId = JOB_OUTCOME_PRINTED, res.CupsJobId
+	c.logger.Info(r.Context(), "test page printed", "job_id", res.JobId, "cups_job_id", res.CupsJobId, "file", printed.filePathName, "output", string(printed.output))
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// Start the job history record for a print, assuming it fails until the label is printed
+//
+// Only requests which pass validation become jobs; rejected requests never reach the printer, so they aren't recorded.
+func (c *PrintLeftoverLabelController) newJobRecord(rb PrintLabelRequestBody) JobRecord {
+
+	return JobRecord{
+		JobId:     c.newJobId(),
+		LabelText: rb.LabelText,
+		Quantity:  rb.Quantity,
+		CreatedAt: time.Now().UTC(),
+		Outcome:   JOB_OUTCOME_FAILED,
+	}
+}
+
+// report whether the Accept header ranks application/pdf above JSON, which is the default when there is no preference
+func prefersPdf(accept string) bool {
+	var pdfQ, jsonQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if k, v, found := strings.Cut(strings.TrimSpace(param), "="); found && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/pdf":
+			pdfQ = math.Max(pdfQ, q)
+		case "application/json", "application/*", "*/*":
+			jsonQ = math.Max(jsonQ, q)
+		}
+	}
+
+	return pdfQ > 0 && pdfQ > jsonQ
+}
+
+// respond to a failed PDF generation, returning the error code sent; text the fonts can't render is the client's problem, anything else is ours
+func (c *PrintLeftoverLabelController) writePdfGenerationError(w http.ResponseWriter, r *http.Request, err error, msg string) string {
+	var unsupported *pdf.UnsupportedCharactersError
+	if errors.As(err, &unsupported) {
+		writeJsonError(w, http.StatusBadRequest, ERR_UNSUPPORTED_CHARACTERS, unsupported.Error())
+		return ERR_UNSUPPORTED_CHARACTERS
+	}
+
+	c.logger.Error(r.Context(), "unable to generate PDF", "stage", "generate_pdf", "err", err)
+	writeJsonError(w, http.StatusInternalServerError, ERR_PDF_GENERATION_FAILED, msg)
+	return ERR_PDF_GENERATION_FAILED
+}
+
+// take a print slot, waiting up to the queue timeout; returns false if none became free or the client went away
+func (c *PrintLeftoverLabelController) acquirePrintSlot(r *http.Request) bool {
+	select {
+	case c.printSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(c.printQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case c.printSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (c *PrintLeftoverLabelController) releasePrintSlot() {
+	<-c.printSlots
+}
+
+// identify the printer and build on the test page, cut to fit and held to the same rules as a requested dateDescriptor;
+// a long queue name or version is truncated, and one the fonts can't render is left out
+func (c *PrintLeftoverLabelController) testPageDateDescriptor() string {
+	candidates := []string{
+		fmt.Sprintf("%v %v", c.printerName, buildinfo.Version),
+		c.printerName,
+		buildinfo.Version,
+	}
+	for _, dd := range candidates {
+		if utf8.RuneCountInString(dd) > MAX_DATE_DESCRIPTOR_LENGTH {
+			dd = strings.TrimSpace(string([]rune(dd)[:MAX_DATE_DESCRIPTOR_LENGTH]))
+		}
+		if dd != "" && pdf.ValidateDateDescriptor(dd, c.labelOptions.Fonts) == nil {
+			return dd
+		}
+	}
+
+	// checked at startup, so always printable
+	return c.defaultDateDescriptor
+}
+
+// combine the deployment's label settings with those requested by the client
+func (c *PrintLeftoverLabelController) labelOptionsFor(rb PrintLabelRequestBody) pdf.Options {
+	opts := c.labelOptions
+	opts.ShelfLifeDays = rb.ShelfLifeDays
+	opts.Orientation = rb.Orientation
+	opts.Style = rb.style
+
+	return opts
 }
@@ -2,10 +2,22 @@ package server_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"src/internal/buildinfo"
+	"src/internal/pdf"
 	"src/internal/server"
+	"src/internal/system"
 	"src/internal/utils"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestPrintLeftoverLabelController(t *testing.T) {
@@ -16,103 +28,1335 @@ func TestPrintLeftoverLabelController(t *testing.T) {
 			ReqMethod:          "GET",
 			ReqBody:            nil,
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "This endpoint only supports POST requests\n",
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports POST requests","code":"method_not_allowed"}`,
 		},
 		// should fail because incorrect HTTP method
 		{
 			ReqMethod:          "PUT",
 			ReqBody:            nil,
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "This endpoint only supports POST requests\n",
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports POST requests","code":"method_not_allowed"}`,
 		},
 		// should fail because incorrect HTTP method
 		{
 			ReqMethod:          "CHANGE",
 			ReqBody:            nil,
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "This endpoint only supports POST requests\n",
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports POST requests","code":"method_not_allowed"}`,
 		},
-		// should fail because the body is malformed
+		// should fail because there is no body
+		{
+			ReqMethod:          "POST",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"Request body not provided","code":"missing_body"}`,
+		},
+		// should fail because the body is empty
 		{
 			ReqMethod:          "POST",
-			ReqBody:            bytes.NewBufferString("some text"),
+			ReqBody:            bytes.NewBufferString(""),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "Malformed request body\n",
+			ExpectedMessage:    `{"status":"error","message":"Request body is empty","code":"missing_body"}`,
+		},
+		// should fail because the body is malformed
+		{
+			ReqMethod:           "POST",
+			ReqBody:             bytes.NewBufferString("some text"),
+			ExpectedStatusCode:  http.StatusBadRequest,
+			ExpectedMessage:     `{"status":"error","message":"Malformed request body","code":"malformed_body"}`,
+			ExpectedContentType: "application/json",
 		},
 		// should fail because the body is missing the quantity field
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor"}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "invalid quantity: value must be a positive integer\n",
+			ExpectedMessage:    `{"status":"error","message":"invalid quantity: value must be a positive integer","code":"invalid_quantity","errors":[{"field":"quantity","message":"invalid quantity: value must be a positive integer","code":"invalid_quantity"}]}`,
 		},
 		// should fail because the body is missing the labelText field
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"quantity":2}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "no value provided for labelText\n",
+			ExpectedMessage:    `{"status":"error","message":"no value provided for labelText","code":"missing_label_text","errors":[{"field":"labelText","message":"no value provided for labelText","code":"missing_label_text"}]}`,
 		},
 		// should fail because the body has an additional, unknown field
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2,"foo":"bar"}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "json: unknown field \"foo\"\n",
+			ExpectedMessage:    `{"status":"error","message":"json: unknown field \"foo\"","code":"unknown_field"}`,
 		},
 		// should fail because a payload field has an incorrect type
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":2,"quantity":2}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "Malformed request body\n",
+			ExpectedMessage:    `{"status":"error","message":"Malformed request body","code":"malformed_body"}`,
 		},
 		// should fail because payload is too large
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor sit amet, consectetuer adipiscing elit. Aenean commodo ligula eget dolor. Aenean massa.","quantity":2}`),
 			ExpectedStatusCode: http.StatusRequestEntityTooLarge,
-			ExpectedMessage:    "Request body is too large\n",
+			ExpectedMessage:    `{"status":"error","message":"Request body is too large","code":"body_too_large"}`,
 		},
 		// should fail because quantity is zero
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":0}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "invalid quantity: value must be a positive integer\n",
+			ExpectedMessage:    `{"status":"error","message":"invalid quantity: value must be a positive integer","code":"invalid_quantity","errors":[{"field":"quantity","message":"invalid quantity: value must be a positive integer","code":"invalid_quantity"}]}`,
 		},
 		// should fail because the dateDescriptor has too many characters
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":100, "dateDescriptor":"this is far too long:"}`),
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedMessage:    "value for dateDescriptor has too many characters: try something shorter\n",
+			ExpectedMessage:    `{"status":"error","message":"value for dateDescriptor has too many characters: try something shorter","code":"date_descriptor_too_long","errors":[{"field":"dateDescriptor","message":"value for dateDescriptor has too many characters: try something shorter","code":"date_descriptor_too_long"}]}`,
+		},
+		// should pass because labelText is exactly the maximum length (counted in runes, not bytes)
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"crème brûlée glacé","quantity":2}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}`,
+		},
+		// should pass because dateDescriptor is exactly the maximum length (counted in runes, like labelText)
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2,"dateDescriptor":"crème brûlée, glacé:"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}`,
+		},
+		// should fail because labelText is one character over the maximum length
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"crème brûlée glacée","quantity":2}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for labelText has too many characters: try something shorter","code":"label_text_too_long","errors":[{"field":"labelText","message":"value for labelText has too many characters: try something shorter","code":"label_text_too_long"}]}`,
 		},
 		// should fail on PDF generation
 		{
 			ReqMethod:          "POST",
-			ReqBody:            bytes.NewBufferString(`{"labelText":"PDF GENERATION FAIL - WRITE ERROR","quantity":2}`),
+			ReqBody:            bytes.NewBufferString(`{"labelText":"PDF GEN FAIL","quantity":2}`),
 			ExpectedStatusCode: http.StatusInternalServerError,
-			ExpectedMessage:    "Error preparing label for printing\n",
+			ExpectedMessage:    `{"status":"error","message":"Error preparing label for printing","code":"pdf_generation_failed"}`,
 		},
 		// should fail on PDF printing (quantity 100 is the trigger)
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":100}`),
 			ExpectedStatusCode: http.StatusInternalServerError,
-			ExpectedMessage:    "Error printing label\n",
+			ExpectedMessage:    `{"status":"error","message":"Error printing label","code":"print_failed"}`,
+		},
+		// should pass
+		{
+			ReqMethod:           "POST",
+			ReqBody:             bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`),
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedMessage:     `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}`,
+			ExpectedContentType: "application/json",
+		},
+	}
+
+	// initialize test controller; the quantity cap is raised so the mock printer's failure trigger can be reached
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId:         utils.MockNewJobId,
+		SpoolDir:         t.TempDir(),
+		MaxLabelQuantity: 100,
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+}
+
+// an empty dateDescriptor should be replaced by the deployment's configured default before generating the PDF
+func TestPrintLeftoverLabelController_DefaultDateDescriptor(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should use the configured default
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should use the value provided in the request
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1,"dateDescriptor":"frozen:"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+	}
+
+	var descriptors []string
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		descriptors = append(descriptors, dateDescriptor)
+		return utils.MockGeneratePdf(labelText, dateDescriptor, opts)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		DefaultDateDescriptor: "bought:",
+		SpoolDir:              t.TempDir(),
+		NewJobId:              utils.MockNewJobId,
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(descriptors) != 2 || descriptors[0] != "bought:" || descriptors[1] != "frozen:" {
+		t.Errorf("unexpected date descriptors passed to generatePdf: got %q want %q", descriptors, []string{"bought:", "frozen:"})
+	}
+}
+
+// the preview endpoint should validate like the print endpoint, but respond with the PDF instead of printing it
+func TestPreviewLeftoverLabelHandler(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "GET",
+			ReqBody:            nil,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports POST requests","code":"method_not_allowed"}`,
+		},
+		// should fail because the body is missing the labelText field
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"quantity":2}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"no value provided for labelText","code":"missing_label_text","errors":[{"field":"labelText","message":"no value provided for labelText","code":"missing_label_text"}]}`,
+		},
+		// should fail on PDF generation
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"PDF GEN FAIL","quantity":2}`),
+			ExpectedStatusCode: http.StatusInternalServerError,
+			ExpectedMessage:    `{"status":"error","message":"Error preparing label preview","code":"pdf_generation_failed"}`,
 		},
+	}
+
+	printed := false
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printed = true
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{SpoolDir: t.TempDir()})
+
+	utils.RequestTester(t, testRequests, c.PreviewLeftoverLabelHandler)
+
+	// should pass and return the PDF document
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`))
+	rr := httptest.NewRecorder()
+	c.PreviewLeftoverLabelHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned incorrect status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("handler returned unexpected Content-Type: got %v want %v", ct, "application/pdf")
+	}
+	if !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+		t.Error("handler response is not a PDF document")
+	}
+	if printed {
+		t.Error("preview handler should never print")
+	}
+}
+
+// generated PDFs should be written to the configured spool directory, and removed once they have been printed
+func TestPrintLeftoverLabelController_SpoolDir(t *testing.T) {
+	var testRequests = []utils.RequestParams{
 		// should pass
 		{
 			ReqMethod:          "POST",
 			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`),
 			ExpectedStatusCode: http.StatusOK,
-			ExpectedMessage:    `{"status":"success"}`,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}`,
+		},
+		// should fail, and still clean up (quantity 100 is the mock print failure trigger)
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":100}`),
+			ExpectedStatusCode: http.StatusInternalServerError,
+			ExpectedMessage:    `{"status":"error","message":"Error printing label","code":"print_failed"}`,
+		},
+	}
+
+	spoolDir := filepath.Join(t.TempDir(), "spool")
+
+	var printed []string
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printed = append(printed, job.FilePathName)
+
+		// the file is in place while it prints, and label content shouldn't be readable by other local users
+		if filepath.Dir(job.FilePathName) != spoolDir || filepath.Ext(job.FilePathName) != ".pdf" {
+			t.Errorf("printPdf was called with an unexpected path: %v", job.FilePathName)
+		}
+		if info, err := os.Stat(job.FilePathName); err != nil {
+			t.Errorf("spool file is missing while printing: %v", err)
+		} else if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("unexpected spool file permissions: got %v want %v", mode, os.FileMode(0600))
+		}
+
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		NewJobId:         utils.MockNewJobId,
+		SpoolDir:         spoolDir,
+		MaxLabelQuantity: 100,
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(printed) != 2 || printed[0] == printed[1] {
+		t.Errorf("expected each request to print its own file, got %v", printed)
+	}
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		t.Fatal("unable to read spool directory:", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected the spool directory to be empty after printing, found %v", entries)
+	}
+}
+
+// concurrent requests must never share a spool file, or one of them would print the other's label
+func TestPrintLeftoverLabelController_ConcurrentSpoolFiles(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string]string)
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		b, err := os.ReadFile(job.FilePathName)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		files[job.FilePathName] = string(b)
+		mu.Unlock()
+		return utils.MockPrintPdf(ctx, job)
+	}
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		return []byte(labelText), nil
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:            t.TempDir(),
+		MaxConcurrentPrints: 10,
+		PrintQueueSize:      10,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			c.PrintLeftoverLabelHandler(rr, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"`+text+`","quantity":1}`)))
+			if rr.Code != http.StatusOK {
+				t.Errorf("unexpected response: %v %v", rr.Code, rr.Body.String())
+			}
+		}(fmt.Sprintf("label %v", i))
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, text := range files {
+		seen[text] = true
+	}
+	if len(files) != 10 || len(seen) != 10 {
+		t.Errorf("expected 10 distinct spool files with distinct labels, got %v", files)
+	}
+}
+
+// text the label fonts can't render should be rejected as a client error, before anything is spooled or recorded
+func TestPrintLeftoverLabelController_UnsupportedCharacters(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because emoji aren't in the label fonts
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Soup 🍲","quantity":1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for labelText contains characters the label font can't print: '🍲'","code":"unsupported_characters","errors":[{"field":"labelText","message":"value for labelText contains characters the label font can't print: '🍲'","code":"unsupported_characters"}]}`,
+		},
+		// should fail because the body font is checked too
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Soup","quantity":1,"dateDescriptor":"✓ made:"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for dateDescriptor contains characters the label font can't print: '✓'","code":"unsupported_characters","errors":[{"field":"dateDescriptor","message":"value for dateDescriptor contains characters the label font can't print: '✓'","code":"unsupported_characters"}]}`,
+		},
+	}
+
+	generated := 0
+	generatePdf := func(lt string, dd string, opts pdf.Options) ([]byte, error) {
+		generated++
+		return pdf.GeneratePdfWithOptions(lt, dd, opts)
+	}
+
+	spoolDir := t.TempDir()
+	jobHistory := server.NewJobHistory(10)
+	c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId:   utils.MockNewJobId,
+		SpoolDir:   spoolDir,
+		JobHistory: jobHistory,
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if generated != 0 {
+		t.Errorf("rejected requests shouldn't reach PDF generation, got %v calls", generated)
+	}
+	if entries, _ := os.ReadDir(spoolDir); len(entries) != 0 {
+		t.Errorf("rejected requests shouldn't create spool files: %v", entries)
+	}
+	if jobs := jobHistory.Recent(); len(jobs) != 0 {
+		t.Errorf("rejected requests shouldn't be recorded as jobs: %+v", jobs)
+	}
+}
+
+// shelfLifeDays is optional, but when provided must be within range and is passed on to PDF generation
+func TestPrintLeftoverLabelController_ShelfLife(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because shelfLifeDays is negative
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1,"shelfLifeDays":-1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"invalid shelfLifeDays: value must be an integer between 0 and 365","code":"invalid_shelf_life","errors":[{"field":"shelfLifeDays","message":"invalid shelfLifeDays: value must be an integer between 0 and 365","code":"invalid_shelf_life"}]}`,
+		},
+		// should fail because shelfLifeDays is over the cap
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1,"shelfLifeDays":366}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"invalid shelfLifeDays: value must be an integer between 0 and 365","code":"invalid_shelf_life","errors":[{"field":"shelfLifeDays","message":"invalid shelfLifeDays: value must be an integer between 0 and 365","code":"invalid_shelf_life"}]}`,
+		},
+		// should fail because shelfLifeDays isn't an integer
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1,"shelfLifeDays":2.5}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"Malformed request body","code":"malformed_body"}`,
+		},
+		// should pass without a shelf life
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should pass with a shelf life
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":1,"shelfLifeDays":4}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+	}
+
+	var shelfLives []*int
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		shelfLives = append(shelfLives, opts.ShelfLifeDays)
+		return utils.MockGeneratePdf(labelText, dateDescriptor, opts)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(shelfLives) != 2 || shelfLives[0] != nil || shelfLives[1] == nil || *shelfLives[1] != 4 {
+		t.Errorf("unexpected shelf lives passed to generatePdf: %v", shelfLives)
+	}
+}
+
+// each failure branch should emit an error event identifying the stage that failed
+func TestPrintLeftoverLabelController_Logging(t *testing.T) {
+	// a regular file can't be used as the spool directory
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0600); err != nil {
+		t.Fatal("[meta] test error - unable to create file:", err)
+	}
+
+	tests := []struct {
+		name          string
+		spoolDir      string
+		body          string
+		expectedLevel string
+		expectedStage any
+	}{
+		{"spool failure", notADir, `{"labelText":"Lorem ipsum dolor","quantity":2}`, "ERROR", "spool_create"},
+		{"pdf failure", t.TempDir(), `{"labelText":"PDF GEN FAIL","quantity":2}`, "ERROR", "generate_pdf"},
+		{"print failure", t.TempDir(), `{"labelText":"Lorem ipsum dolor","quantity":100}`, "ERROR", "print"},
+		{"success", t.TempDir(), `{"labelText":"Lorem ipsum dolor","quantity":2}`, "INFO", nil},
+	}
+
+	for _, tt := range tests {
+		logger := &utils.MockLogger{}
+		c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+			SpoolDir:         tt.spoolDir,
+			Logger:           logger,
+			MaxLabelQuantity: 100,
+		})
+
+		c.PrintLeftoverLabelHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewBufferString(tt.body)))
+
+		if len(logger.Entries) != 1 {
+			t.Errorf("%v: expected exactly one log entry, got %v", tt.name, logger.Entries)
+			continue
+		}
+		e := logger.Entries[0]
+		if e.Level != tt.expectedLevel || e.Value("stage") != tt.expectedStage {
+			t.Errorf("%v: unexpected log entry: got level=%v stage=%v, want level=%v stage=%v", tt.name, e.Level, e.Value("stage"), tt.expectedLevel, tt.expectedStage)
+		}
+		if tt.expectedStage != "generate_pdf" && e.Value("file") == nil {
+			t.Errorf("%v: log entry is missing the spool file name", tt.name)
+		}
+	}
+}
+
+// no more than MaxConcurrentPrints requests should be handled at once; requests that can't get a slot in time receive a 503
+func TestPrintLeftoverLabelController_ConcurrentPrints(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 5)
+
+	var mu sync.Mutex
+	printing, maxPrinting := 0, 0
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		mu.Lock()
+		printing++
+		if printing > maxPrinting {
+			maxPrinting = printing
+		}
+		mu.Unlock()
+		started <- struct{}{}
+
+		<-release
+
+		mu.Lock()
+		printing--
+		mu.Unlock()
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:            t.TempDir(),
+		MaxConcurrentPrints: 2,
+		PrintQueueTimeout:   50 * time.Millisecond,
+	})
+
+	results := make(chan *httptest.ResponseRecorder, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`))
+			rr := httptest.NewRecorder()
+			c.PrintLeftoverLabelHandler(rr, req)
+			results <- rr
+		}()
+	}
+
+	// two requests hold the slots, one printing and one queued behind it for the printer; the other three time out waiting
+	<-started
+	for i := 0; i < 3; i++ {
+		rr := <-results
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected a 503 for a request beyond the limit, got %v %v", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("503 response is missing a Retry-After header")
+		}
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if rr := <-results; rr.Code != http.StatusOK {
+			t.Errorf("expected the printing requests to succeed, got %v %v", rr.Code, rr.Body.String())
+		}
+	}
+
+	// jobs for the same printer are never printed at the same time
+	if maxPrinting != 1 {
+		t.Errorf("printPdf ran %v times concurrently, want 1", maxPrinting)
+	}
+
+	// the slots are free again once the prints finish
+	rr := httptest.NewRecorder()
+	c.PrintLeftoverLabelHandler(rr, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a request after the prints finished to succeed, got %v %v", rr.Code, rr.Body.String())
+	}
+}
+
+// a print command that hangs should be cancelled once the print timeout passes, failing the request with a 504
+func TestPrintLeftoverLabelController_PrintTimeout(t *testing.T) {
+	// printPdf runs on the print queue's worker, so hand its context over through a channel
+	printCtxs := make(chan context.Context, 1)
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printCtxs <- ctx
+		// block like a hung lp process until the deadline kills it
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:     t.TempDir(),
+		PrintTimeout: 20 * time.Millisecond,
+	})
+
+	utils.RequestTester(t, []utils.RequestParams{
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`),
+			ExpectedStatusCode: http.StatusGatewayTimeout,
+			ExpectedMessage:    `{"status":"error","message":"Timed out waiting for the printer","code":"print_timeout"}`,
+		},
+	}, c.PrintLeftoverLabelHandler)
+
+	var printCtx context.Context
+	select {
+	case printCtx = <-printCtxs:
+	default:
+		t.Fatal("printPdf was not called")
+	}
+	if _, ok := printCtx.Deadline(); !ok {
+		t.Error("printPdf was called without a deadline")
+	}
+}
+
+// a successful print should describe the job: a server-side ID, the CUPS job ID (when lp reports one), the printer and copies
+func TestPrintLeftoverLabelController_Response(t *testing.T) {
+	// lpr prints nothing on success, so there's no CUPS job ID to report
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		return nil, nil
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{SpoolDir: t.TempDir()})
+
+	send := func() server.PrintLabelResponseBody {
+		rr := httptest.NewRecorder()
+		c.PrintLeftoverLabelHandler(rr, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":3}`)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected response: %v %v", rr.Code, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "cupsJobId") {
+			t.Errorf("cupsJobId should be omitted when the print command doesn't report one: %v", rr.Body.String())
+		}
+
+		var res server.PrintLabelResponseBody
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("response is not valid JSON: %v", err)
+		}
+		return res
+	}
+
+	first, second := send(), send()
+	if first.Status != "success" || first.Printer != "dymo" || first.Copies != 3 {
+		t.Errorf("unexpected response: %+v", first)
+	}
+	if first.JobId == "" || first.JobId == second.JobId {
+		t.Errorf("expected a unique job ID per print: got %q and %q", first.JobId, second.JobId)
+	}
+}
+
+// CUPS options from the request should be checked against the allowlist and passed on to the print command
+func TestPrintLeftoverLabelController_PrintOptions(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because the option isn't on the allowlist
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"options":{"job-hold-until":"indefinite"}}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"unsupported print option \"job-hold-until\": must be one of Collate, fit-to-page, media, orientation-requested, print-quality, print-scaling","code":"invalid_print_option","errors":[{"field":"options","message":"unsupported print option \"job-hold-until\": must be one of Collate, fit-to-page, media, orientation-requested, print-quality, print-scaling","code":"invalid_print_option"}]}`,
+		},
+		// should fail because the value would be split into several options
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"options":{"media":"a job-hold-until=x"}}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"invalid value for print option \"media\": use up to 64 letters, digits, '.', '_' or '-'","code":"invalid_print_option","errors":[{"field":"options","message":"invalid value for print option \"media\": use up to 64 letters, digits, '.', '_' or '-'","code":"invalid_print_option"}]}`,
+		},
+		// should pass
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"options":{"media":"w79h252"}}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+	}
+
+	var printed []map[string]string
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printed = append(printed, job.Options)
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(printed) != 1 || printed[0]["media"] != "w79h252" {
+		t.Errorf("unexpected options passed to printPdf: %v", printed)
+	}
+}
+
+// clients that accept application/pdf should get the printed document back instead of the JSON status
+func TestPrintLeftoverLabelController_AcceptPdf(t *testing.T) {
+	label, _ := utils.MockGeneratePdf("", "", pdf.Options{})
+
+	tests := []struct {
+		accept              string
+		expectedContentType string
+	}{
+		{"", "application/json"},
+		{"application/json", "application/json"},
+		{"*/*", "application/json"},
+		{"application/pdf", "application/pdf"},
+		{"application/json;q=0.5, application/pdf", "application/pdf"},
+		{"application/pdf;q=0.5, application/json", "application/json"},
+	}
+
+	for _, tt := range tests {
+		printCount := 0
+		printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+			printCount++
+			return utils.MockPrintPdf(ctx, job)
+		}
+
+		c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+			NewJobId: utils.MockNewJobId,
+			SpoolDir: t.TempDir(),
+		})
+
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":2}`))
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		c.PrintLeftoverLabelHandler(rr, req)
+
+		if rr.Code != http.StatusOK || printCount != 1 {
+			t.Errorf("Accept %q: expected the label to print once, got status %v and %v prints", tt.accept, rr.Code, printCount)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+			t.Errorf("Accept %q: unexpected Content-Type: got %v want %v", tt.accept, ct, tt.expectedContentType)
+		}
+
+		if tt.expectedContentType == "application/pdf" {
+			if !bytes.Equal(rr.Body.Bytes(), label) {
+				t.Errorf("Accept %q: response body is not the generated PDF", tt.accept)
+			}
+			if id := rr.Header().Get("X-Print-Job-Id"); id != "test-job" {
+				t.Errorf("Accept %q: unexpected X-Print-Job-Id: %q", tt.accept, id)
+			}
+		} else if rr.Body.String() != `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":2}` {
+			t.Errorf("Accept %q: unexpected body: %v", tt.accept, rr.Body.String())
+		}
+	}
+}
+
+// line breaks, tabs and other control characters would garble the label, so they're rejected in both text fields
+func TestPrintLeftoverLabelController_ControlCharacters(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because labelText contains a line break
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem\nipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[{"field":"labelText","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+		// should fail because labelText contains a NUL byte
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem\u0000ipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[{"field":"labelText","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+		// should fail because dateDescriptor contains a tab
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"dateDescriptor":"made\ton:"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[{"field":"dateDescriptor","message":"value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+		// should fail because dateDescriptor contains an escape character
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"dateDescriptor":"\u001b[31m"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[{"field":"dateDescriptor","message":"value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+		// should fail because labelText is only whitespace
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":" \n ","quantity":1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"no value provided for labelText","code":"missing_label_text","errors":[{"field":"labelText","message":"no value provided for labelText","code":"missing_label_text"}]}`,
+		},
+		// should pass because surrounding whitespace is trimmed
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"  Lorem ipsum\n","quantity":1,"dateDescriptor":" frozen: "}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should pass because a non-breaking space is a space like any other
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem\u00a0ipsum","quantity":1,"dateDescriptor":"made\u00a0on:"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should fail because a zero-width space is an invisible formatting character
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem\u200bipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[{"field":"labelText","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+	}
+
+	var labels []string
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		labels = append(labels, labelText+"|"+dateDescriptor)
+		return utils.MockGeneratePdf(labelText, dateDescriptor, opts)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(labels) != 2 || labels[0] != "Lorem ipsum|frozen:" || labels[1] != "Lorem\u00a0ipsum|made\u00a0on:" {
+		t.Errorf("unexpected text passed to generatePdf: %q", labels)
+	}
+}
+
+// the test page should print one fixed diagnostic label through the normal print path, without a request body
+func TestPrintLeftoverLabelController_PrintTestPage(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "GET",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports POST requests","code":"method_not_allowed"}`,
+		},
+		// should pass without a body
+		{
+			ReqMethod:          "POST",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"zebra","copies":1}`,
+		},
+	}
+
+	var labelText, dateDescriptor string
+	var labelOpts pdf.Options
+	generatePdf := func(lt string, dd string, opts pdf.Options) ([]byte, error) {
+		labelText, dateDescriptor, labelOpts = lt, dd, opts
+		return utils.MockGeneratePdf(lt, dd, opts)
+	}
+
+	var printed []system.PrintJob
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printed = append(printed, job)
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:    t.TempDir(),
+		PrinterName: "zebra",
+		NewJobId:    utils.MockNewJobId,
+	})
+
+	before := time.Now()
+	utils.RequestTester(t, testRequests, c.PrintTestPageHandler)
+
+	if labelText != "Test page" || dateDescriptor != "zebra "+buildinfo.Version {
+		t.Errorf("unexpected test page content: %q %q", labelText, dateDescriptor)
+	}
+	if labelOpts.DateLayout != server.TEST_PAGE_DATE_LAYOUT || labelOpts.Date.Before(before) {
+		t.Errorf("test page should show the current time: layout %q, date %v", labelOpts.DateLayout, labelOpts.Date)
+	}
+	if len(printed) != 1 || printed[0].Quantity != 1 || printed[0].Printer != "zebra" {
+		t.Errorf("unexpected print jobs: %+v", printed)
+	}
+}
+
+// the test page's printer name and version come from the deployment, not the client, but still have to fit on the label
+func TestPrintLeftoverLabelController_PrintTestPageDateDescriptor(t *testing.T) {
+	version := buildinfo.Version
+	t.Cleanup(func() { buildinfo.Version = version })
+
+	tests := []struct {
+		printer  string
+		version  string
+		expected string
+	}{
+		{"zebra", "v1.2.3", "zebra v1.2.3"},
+		// too long together: truncated to the limit, without a dangling space
+		{"zebra", "v1.2.3-14-gabcdef1-dirty", "zebra v1.2.3-14-gabc"},
+		{"Kitchen_Label_Printer", "v1.2.3", "Kitchen_Label_Printe"},
+		// a version the fonts can't render is left out
+		{"zebra", "v1.2.3\u2028", "zebra"},
+		{"zebra🍲", "v1.2.3", "v1.2.3"},
+		// nothing usable: fall back to the default descriptor
+		{"🍲", "\t", "made:"},
+	}
+
+	for _, tt := range tests {
+		buildinfo.Version = tt.version
+
+		var dateDescriptor string
+		generatePdf := func(lt string, dd string, opts pdf.Options) ([]byte, error) {
+			dateDescriptor = dd
+			return utils.MockGeneratePdf(lt, dd, opts)
+		}
+		c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+			SpoolDir:    t.TempDir(),
+			PrinterName: tt.printer,
+			NewJobId:    utils.MockNewJobId,
+		})
+
+		rr := httptest.NewRecorder()
+		c.PrintTestPageHandler(rr, httptest.NewRequest("POST", "/", nil))
+
+		if rr.Code != http.StatusOK || dateDescriptor != tt.expected {
+			t.Errorf("%q %q: expected %q, got %q (status %v)", tt.printer, tt.version, tt.expected, dateDescriptor, rr.Code)
+		}
+	}
+}
+
+// requests for more copies than the configured cap should be rejected before anything is printed
+func TestPrintLeftoverLabelController_MaxLabelQuantity(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should pass because quantity is exactly the default cap
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":50}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":50}`,
+		},
+		// should fail because quantity is one over the default cap
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":51}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"invalid quantity: no more than 50 labels can be printed at once","code":"quantity_too_large","errors":[{"field":"quantity","message":"invalid quantity: no more than 50 labels can be printed at once","code":"quantity_too_large"}]}`,
 		},
 	}
 
-	// initialize test controller
-	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf)
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
 
+	// a lower cap applies at its own boundary
+	testRequests = []utils.RequestParams{
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":5}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":5}`,
+		},
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum dolor","quantity":6}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"invalid quantity: no more than 5 labels can be printed at once","code":"quantity_too_large","errors":[{"field":"quantity","message":"invalid quantity: no more than 5 labels can be printed at once","code":"quantity_too_large"}]}`,
+		},
+	}
+
+	c = server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId:         utils.MockNewJobId,
+		SpoolDir:         t.TempDir(),
+		MaxLabelQuantity: 5,
+	})
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+}
+
+// every invalid field should be reported in one response, in the order the fields are checked
+func TestPrintLeftoverLabelController_ValidationErrors(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should fail on labelText, quantity, dateDescriptor and shelfLifeDays all at once
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"","quantity":0,"dateDescriptor":"this is far too long:","shelfLifeDays":-1}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage: `{"status":"error","message":"no value provided for labelText","code":"missing_label_text","errors":[` +
+				`{"field":"labelText","message":"no value provided for labelText","code":"missing_label_text"},` +
+				`{"field":"quantity","message":"invalid quantity: value must be a positive integer","code":"invalid_quantity"},` +
+				`{"field":"dateDescriptor","message":"value for dateDescriptor has too many characters: try something shorter","code":"date_descriptor_too_long"},` +
+				`{"field":"shelfLifeDays","message":"invalid shelfLifeDays: value must be an integer between 0 and 365","code":"invalid_shelf_life"}]}`,
+		},
+		// should fail on both text fields, each reported once with its first problem
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"far\ttoo long for the label","quantity":51,"dateDescriptor":"made\non:"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage: `{"status":"error","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters","errors":[` +
+				`{"field":"labelText","message":"value for labelText contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"},` +
+				`{"field":"quantity","message":"invalid quantity: no more than 50 labels can be printed at once","code":"quantity_too_large"},` +
+				`{"field":"dateDescriptor","message":"value for dateDescriptor contains characters that can't be printed, such as line breaks or tabs","code":"invalid_characters"}]}`,
+		},
+	}
+
+	printed := false
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printed = true
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{SpoolDir: t.TempDir()})
 	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if printed {
+		t.Error("an invalid request was printed")
+	}
+}
+
+// a request may send its label to one of the configured printers instead of the default, but to no other
+func TestPrintLeftoverLabelController_PrinterName(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should pass and print to the default printer
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should pass and print to the chosen printer
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"printerName":"pantry"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"pantry","copies":1}`,
+		},
+		// should fail because the printer isn't in the allowlist
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"printerName":"office"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for printerName is not one of the configured printers","code":"unknown_printer","errors":[{"field":"printerName","message":"value for printerName is not one of the configured printers","code":"unknown_printer"}]}`,
+		},
+	}
+
+	var printers []string
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printers = append(printers, job.Printer)
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		NewJobId:        utils.MockNewJobId,
+		SpoolDir:        t.TempDir(),
+		AllowedPrinters: []string{"pantry", "garage"},
+	})
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if strings.Join(printers, ",") != "dymo,pantry" {
+		t.Errorf("labels were sent to unexpected printers: %v", printers)
+	}
+}
+
+// the orientation should reach the PDF generator, and portrait labels shouldn't be rotated by CUPS
+func TestPrintLeftoverLabelController_Orientation(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should pass with the default orientation
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should pass with a portrait label
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"orientation":"portrait"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should fail because the orientation isn't supported
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"orientation":"diagonal"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"unsupported orientation \"diagonal\": must be \"landscape\" or \"portrait\"","code":"invalid_orientation","errors":[{"field":"orientation","message":"unsupported orientation \"diagonal\": must be \"landscape\" or \"portrait\"","code":"invalid_orientation"}]}`,
+		},
+	}
+
+	var orientations []string
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		orientations = append(orientations, opts.Orientation)
+		return utils.MockGeneratePdf(labelText, dateDescriptor, opts)
+	}
+
+	var printOptions []map[string]string
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		printOptions = append(printOptions, job.Options)
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, printPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if strings.Join(orientations, ",") != ",portrait" {
+		t.Errorf("unexpected orientations passed to generatePdf: %q", orientations)
+	}
+	if len(printOptions) != 2 || printOptions[0]["orientation-requested"] != "" || printOptions[1]["orientation-requested"] != "3" {
+		t.Errorf("unexpected print options: %v", printOptions)
+	}
+}
+
+// hex colors in the request should be parsed into the label style; malformed ones are rejected
+func TestPrintLeftoverLabelController_Colors(t *testing.T) {
+	var testRequests = []utils.RequestParams{
+		// should pass with both colors set, in long and short form
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"titleColor":"#1E90ff","dateColor":"#0a3"}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should pass without colors
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+		},
+		// should fail because neither color is valid hex
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"titleColor":"#12345g","dateColor":"blue"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage: `{"status":"error","message":"value for titleColor must be a hex color like #1e90ff","code":"invalid_color","errors":[` +
+				`{"field":"titleColor","message":"value for titleColor must be a hex color like #1e90ff","code":"invalid_color"},` +
+				`{"field":"dateColor","message":"value for dateColor must be a hex color like #1e90ff","code":"invalid_color"}]}`,
+		},
+		// should fail because the hex color has the wrong number of digits
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1,"titleColor":"#1234"}`),
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"value for titleColor must be a hex color like #1e90ff","code":"invalid_color","errors":[{"field":"titleColor","message":"value for titleColor must be a hex color like #1e90ff","code":"invalid_color"}]}`,
+		},
+	}
+
+	var styles []pdf.Style
+	generatePdf := func(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
+		styles = append(styles, opts.Style)
+		return utils.MockGeneratePdf(labelText, dateDescriptor, opts)
+	}
+
+	c := server.NewPrintLeftoverLabelController(generatePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+		NewJobId: utils.MockNewJobId,
+		SpoolDir: t.TempDir(),
+	})
+	utils.RequestTester(t, testRequests, c.PrintLeftoverLabelHandler)
+
+	if len(styles) != 2 {
+		t.Fatalf("expected two labels to be generated, got %v", len(styles))
+	}
+	if s := styles[0]; s.TitleColor == nil || *s.TitleColor != (pdf.Color{R: 30, G: 144, B: 255}) || s.DateColor == nil || *s.DateColor != (pdf.Color{R: 0, G: 170, B: 51}) {
+		t.Errorf("unexpected style: %+v", s)
+	}
+	if s := styles[1]; s.TitleColor != nil || s.DateColor != nil {
+		t.Errorf("expected the default style, got %+v", s)
+	}
+}
+
+// the body size limit should apply at exactly the configured number of bytes, falling back to the default
+func TestPrintLeftoverLabelController_MaxRequestBodySize(t *testing.T) {
+	// pad a valid body with insignificant whitespace to exactly `size` bytes
+	body := func(size int) *bytes.Buffer {
+		b := `{"labelText":"Lorem ipsum","quantity":1}`
+		return bytes.NewBufferString(b[:len(b)-1] + strings.Repeat(" ", size-len(b)) + "}")
+	}
+
+	for _, tt := range []struct {
+		maxRequestBodySize int
+		limit              int
+	}{
+		{0, server.DEFAULT_MAX_REQUEST_BODY_SIZE},
+		{64, 64},
+		{512, 512},
+	} {
+		c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+			NewJobId:           utils.MockNewJobId,
+			SpoolDir:           t.TempDir(),
+			MaxRequestBodySize: tt.maxRequestBodySize,
+		})
+
+		t.Logf("limit: %v bytes", tt.limit)
+		utils.RequestTester(t, []utils.RequestParams{
+			// should pass because the body is exactly at the limit
+			{
+				ReqMethod:          "POST",
+				ReqBody:            body(tt.limit),
+				ExpectedStatusCode: http.StatusOK,
+				ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":1}`,
+			},
+			// should fail because the body is one byte over the limit
+			{
+				ReqMethod:          "POST",
+				ReqBody:            body(tt.limit + 1),
+				ExpectedStatusCode: http.StatusRequestEntityTooLarge,
+				ExpectedMessage:    `{"status":"error","message":"Request body is too large","code":"body_too_large"}`,
+			},
+		}, c.PrintLeftoverLabelHandler)
+	}
+}
+
+// a request using every optional field is too large for the default body size limit, but fits the 1 KiB the readme suggests
+func TestPrintLeftoverLabelController_FullRequestBody(t *testing.T) {
+	const suggestedLimit = 1024
+
+	full := `{"labelText":"Chicken and leeks!","dateDescriptor":"bought at market on:","quantity":2,"shelfLifeDays":5,` +
+		`"printerName":"kitchen_labelwriter_450","orientation":"portrait","titleColor":"#112233","dateColor":"#445566",` +
+		`"options":{"media":"w54h144","print-quality":"High","print-scaling":"fit","fit-to-page":"true","Collate":"False"}}`
+
+	for _, limit := range []int{0, suggestedLimit} {
+		c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, utils.MockPrintPdf, server.PrintLeftoverLabelOptions{
+			NewJobId:           utils.MockNewJobId,
+			SpoolDir:           t.TempDir(),
+			AllowedPrinters:    []string{"kitchen_labelwriter_450"},
+			MaxRequestBodySize: limit,
+		})
+
+		expected := utils.RequestParams{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(full),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"kitchen_labelwriter_450","copies":2}`,
+		}
+		// should fail with the default limit, which only leaves room for the basic fields
+		if limit == 0 {
+			expected.ExpectedStatusCode = http.StatusRequestEntityTooLarge
+			expected.ExpectedMessage = `{"status":"error","message":"Request body is too large","code":"body_too_large"}`
+		}
+
+		utils.RequestTester(t, []utils.RequestParams{expected}, c.PrintLeftoverLabelHandler)
+	}
+}
+
+// the deployment's cut setting should be passed on with every print job
+func TestPrintLeftoverLabelController_CutBetweenCopies(t *testing.T) {
+	for _, cut := range []bool{false, true} {
+		var jobs []system.PrintJob
+		printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+			jobs = append(jobs, job)
+			return utils.MockPrintPdf(ctx, job)
+		}
+
+		c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+			SpoolDir:         t.TempDir(),
+			CutBetweenCopies: cut,
+		})
+		c.PrintLeftoverLabelHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":3}`)))
+
+		if len(jobs) != 1 || jobs[0].CutBetweenCopies != cut || jobs[0].Quantity != 3 {
+			t.Errorf("cut %v: unexpected print jobs: %+v", cut, jobs)
+		}
+	}
+}
+
+// in cut mode each copy gets the full print timeout, and a run that times out partway says how many labels were printed
+func TestPrintLeftoverLabelController_CutBetweenCopiesTimeout(t *testing.T) {
+	const printTimeout = 20 * time.Millisecond
+
+	var remaining, copyTimeout time.Duration
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		deadline, _ := ctx.Deadline()
+		remaining, copyTimeout = time.Until(deadline), job.CopyTimeout
+
+		// the first two copies print, then the printer hangs on the third
+		<-ctx.Done()
+		return []byte("request id is dymo-42 (1 file(s))"), &system.PartialPrintError{Printed: 2, Total: job.Quantity, Err: ctx.Err()}
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:         t.TempDir(),
+		CutBetweenCopies: true,
+		PrintTimeout:     printTimeout,
+	})
+
+	utils.RequestTester(t, []utils.RequestParams{
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":3}`),
+			ExpectedStatusCode: http.StatusGatewayTimeout,
+			ExpectedMessage:    `{"status":"error","message":"Timed out waiting for the printer after 2 of 3 labels were printed","code":"print_timeout"}`,
+		},
+	}, c.PrintLeftoverLabelHandler)
+
+	if remaining <= 2*printTimeout {
+		t.Errorf("3 copies should have 3 print timeouts to print in, had %v", remaining)
+	}
+	if copyTimeout != printTimeout {
+		t.Errorf("each copy should be limited to the print timeout, got %v", copyTimeout)
+	}
+}
+
+// a single copy that hangs is killed on its own timeout, and is reported like any other timeout
+func TestPrintLeftoverLabelController_CopyTimeout(t *testing.T) {
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		// the printing function kills the hung copy itself, long before the job's deadline
+		return nil, &system.PartialPrintError{Printed: 1, Total: job.Quantity, Err: fmt.Errorf("%w: signal: killed", context.DeadlineExceeded)}
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:         t.TempDir(),
+		CutBetweenCopies: true,
+	})
+
+	utils.RequestTester(t, []utils.RequestParams{
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":3}`),
+			ExpectedStatusCode: http.StatusGatewayTimeout,
+			ExpectedMessage:    `{"status":"error","message":"Timed out waiting for the printer after 1 of 3 labels were printed","code":"print_timeout"}`,
+		},
+	}, c.PrintLeftoverLabelHandler)
+}
+
+// however many copies are printed, the job has to end before the server's write timeout cuts the response off
+func TestPrintLeftoverLabelController_WriteTimeout(t *testing.T) {
+	const writeTimeout = 600 * time.Millisecond
+
+	var remaining time.Duration
+	printPdf := func(ctx context.Context, job system.PrintJob) ([]byte, error) {
+		deadline, _ := ctx.Deadline()
+		remaining = time.Until(deadline)
+		return utils.MockPrintPdf(ctx, job)
+	}
+
+	c := server.NewPrintLeftoverLabelController(utils.MockGeneratePdf, printPdf, server.PrintLeftoverLabelOptions{
+		SpoolDir:         t.TempDir(),
+		CutBetweenCopies: true,
+		WriteTimeout:     writeTimeout,
+		NewJobId:         utils.MockNewJobId,
+	})
+
+	utils.RequestTester(t, []utils.RequestParams{
+		{
+			ReqMethod:          "POST",
+			ReqBody:            bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":3}`),
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedMessage:    `{"status":"success","jobId":"test-job","cupsJobId":"dymo-42","printer":"dymo","copies":3}`,
+		},
+	}, c.PrintLeftoverLabelHandler)
+
+	if remaining <= 0 || remaining > writeTimeout-server.WRITE_TIMEOUT_MARGIN {
+		t.Errorf("the job should end %v before the write timeout, had %v left", server.WRITE_TIMEOUT_MARGIN, remaining)
+	}
 }
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"src/internal/server/config"
+	"src/internal/system"
+	"sync"
+)
+
+const DEFAULT_PRINT_QUEUE_SIZE = config.DEFAULT_PRINT_QUEUE_SIZE
+
+// returned by `PrintQueue.Submit` when too many jobs are already waiting for the printer
+var ErrPrintQueueFull = errors.New("print queue is full")
+
+// Hands print jobs to each printer one at a time, in the order they were submitted
+//
+// CUPS interleaves jobs submitted at the same time unpredictably, so every printer gets a worker fed by a bounded channel;
+// jobs for different printers don't wait for each other.
+type PrintQueue struct {
+	printPdf func(ctx context.Context, job system.PrintJob) ([]byte, error)
+	size     int
+
+	mu      sync.Mutex
+	workers map[string]chan queuedPrintJob
+}
+
+type queuedPrintJob struct {
+	ctx context.Context
+	job system.PrintJob
+	// closed once the job has been handed to the printer
+	started chan struct{}
+	result  chan printResult
+}
+
+type printResult struct {
+	out []byte
+	err error
+}
+
+// Create a PrintQueue which holds up to `size` waiting jobs per printer, not counting the one being printed
+func NewPrintQueue(printPdf func(ctx context.Context, job system.PrintJob) ([]byte, error), size int) *PrintQueue {
+
+	return &PrintQueue{
+		printPdf: printPdf,
+		size:     size,
+		workers:  make(map[string]chan queuedPrintJob),
+	}
+}
+
+// Print `job` once the jobs submitted before it for the same printer are done
+//
+// Returns `ErrPrintQueueFull` straight away if the printer's queue is full. If `ctx` ends while the job is waiting,
+// the job is dropped and the context's error is returned. Once printing has started, the print function's own result is
+// returned, since it knows whether any copies were printed; it must stop when `ctx` ends.
+func (q *PrintQueue) Submit(ctx context.Context, job system.PrintJob) ([]byte, error) {
+	// buffered so the worker never blocks on a submitter that has given up
+	item := queuedPrintJob{ctx: ctx, job: job, started: make(chan struct{}), result: make(chan printResult, 1)}
+
+	select {
+	case q.worker(job.Printer) <- item:
+	default:
+		return nil, ErrPrintQueueFull
+	}
+
+	select {
+	case res := <-item.result:
+		return res.out, res.err
+	case <-ctx.Done():
+		select {
+		case <-item.started:
+			res := <-item.result
+			return res.out, res.err
+		default:
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// get the channel feeding the printer's worker, starting the worker on first use
+func (q *PrintQueue) worker(printer string) chan queuedPrintJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs, ok := q.workers[printer]
+	if !ok {
+		jobs = make(chan queuedPrintJob, q.size)
+		q.workers[printer] = jobs
+		go q.run(jobs)
+	}
+
+	return jobs
+}
+
+func (q *PrintQueue) run(jobs chan queuedPrintJob) {
+	for item := range jobs {
+		// the submitter has already given up on this job
+		if err := item.ctx.Err(); err != nil {
+			item.result <- printResult{err: err}
+			continue
+		}
+
+		close(item.started)
+		out, err := q.printPdf(item.ctx, item.job)
+		item.result <- printResult{out: out, err: err}
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"src/internal/system"
+	"src/internal/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a print function which records the order jobs arrive in and holds each one until released
+type blockingPrinter struct {
+	mu          sync.Mutex
+	printed     []string
+	printing    int
+	maxPrinting int
+	started     chan string
+	release     chan struct{}
+}
+
+func newBlockingPrinter() *blockingPrinter {
+	return &blockingPrinter{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (p *blockingPrinter) printPdf(ctx context.Context, job system.PrintJob) ([]byte, error) {
+	p.mu.Lock()
+	p.printed = append(p.printed, job.FilePathName)
+	p.printing++
+	if p.printing > p.maxPrinting {
+		p.maxPrinting = p.printing
+	}
+	p.mu.Unlock()
+	p.started <- job.FilePathName
+
+	<-p.release
+
+	p.mu.Lock()
+	p.printing--
+	p.mu.Unlock()
+	return []byte("request id is dymo-42 (1 file(s))"), nil
+}
+
+// wait until `n` jobs are queued behind the one printing, so submissions happen in a known order
+func waitForQueued(t *testing.T, q *PrintQueue, printer string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(q.worker(printer)) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v queued jobs", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// jobs submitted concurrently should reach the printer one at a time, in the order they were submitted
+func TestPrintQueue_Order(t *testing.T) {
+	p := newBlockingPrinter()
+	q := NewPrintQueue(p.printPdf, 5)
+
+	var wg sync.WaitGroup
+	submit := func(name string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := q.Submit(context.Background(), system.PrintJob{FilePathName: name, Printer: "dymo"})
+			if err != nil || len(out) == 0 {
+				t.Errorf("unexpected result for %v: %q %v", name, out, err)
+			}
+		}()
+	}
+
+	submit("job-1")
+	<-p.started
+	for i := 2; i <= 5; i++ {
+		submit("job-" + strconv.Itoa(i))
+		waitForQueued(t, q, "dymo", i-1)
+	}
+
+	close(p.release)
+	wg.Wait()
+
+	want := []string{"job-1", "job-2", "job-3", "job-4", "job-5"}
+	if strings.Join(p.printed, ",") != strings.Join(want, ",") {
+		t.Errorf("jobs printed in the wrong order: got %v, want %v", p.printed, want)
+	}
+	if p.maxPrinting != 1 {
+		t.Errorf("printPdf ran %v times concurrently, want 1", p.maxPrinting)
+	}
+}
+
+// a full queue should turn jobs away straight away rather than blocking
+func TestPrintQueue_Full(t *testing.T) {
+	p := newBlockingPrinter()
+	q := NewPrintQueue(p.printPdf, 1)
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-1", Printer: "dymo"})
+		done <- err
+	}()
+	<-p.started
+	go func() {
+		_, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-2", Printer: "dymo"})
+		done <- err
+	}()
+	waitForQueued(t, q, "dymo", 1)
+
+	if _, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-3", Printer: "dymo"}); !errors.Is(err, ErrPrintQueueFull) {
+		t.Errorf("expected ErrPrintQueueFull, got %v", err)
+	}
+
+	// another printer has a queue of its own
+	other := make(chan error, 1)
+	go func() {
+		_, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-4", Printer: "zebra"})
+		other <- err
+	}()
+	if name := <-p.started; name != "job-4" {
+		t.Errorf("expected the other printer's job to start, got %v", name)
+	}
+
+	close(p.release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if err := <-other; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// a job whose context ends while it is queued should be dropped without reaching the printer
+func TestPrintQueue_Cancelled(t *testing.T) {
+	p := newBlockingPrinter()
+	q := NewPrintQueue(p.printPdf, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-1", Printer: "dymo"})
+		done <- err
+	}()
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Submit(ctx, system.PrintJob{FilePathName: "job-2", Printer: "dymo"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the queued job to time out, got %v", err)
+	}
+
+	close(p.release)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the worker skips the abandoned job and carries on with the next one
+	if _, err := q.Submit(context.Background(), system.PrintJob{FilePathName: "job-3", Printer: "dymo"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.printed) != 2 || p.printed[1] != "job-3" {
+		t.Errorf("unexpected jobs printed: %v", p.printed)
+	}
+}
+
+// print requests that find the printer's queue full should fail with a 503 instead of waiting
+func TestPrintLeftoverLabelController_PrintQueueFull(t *testing.T) {
+	p := newBlockingPrinter()
+	c := NewPrintLeftoverLabelController(utils.MockGeneratePdf, p.printPdf, PrintLeftoverLabelOptions{
+		SpoolDir:            t.TempDir(),
+		MaxConcurrentPrints: 3,
+		PrintQueueSize:      1,
+	})
+
+	print := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		c.PrintLeftoverLabelHandler(rr, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"labelText":"Lorem ipsum","quantity":1}`)))
+		return rr
+	}
+
+	results := make(chan *httptest.ResponseRecorder, 2)
+	go func() { results <- print() }()
+	<-p.started
+	go func() { results <- print() }()
+	waitForQueued(t, c.printQueue, DEFAULT_PRINTER_NAME, 1)
+
+	rr := print()
+	want := `{"status":"error","message":"The print queue is full: try again shortly","code":"printer_busy"}`
+	if rr.Code != http.StatusServiceUnavailable || rr.Body.String() != want {
+		t.Errorf("unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("503 response is missing a Retry-After header")
+	}
+
+	close(p.release)
+	for i := 0; i < 2; i++ {
+		if rr := <-results; rr.Code != http.StatusOK {
+			t.Errorf("expected the queued requests to succeed, got %v %v", rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// once this many clients are being tracked, buckets that have fully refilled are discarded
+const MAX_TRACKED_CLIENTS = 1024
+
+// Token bucket rate limiter which can be applied to a handler as middleware
+//
+// When `perClient` is set, each remote IP gets its own bucket; otherwise all requests share a single bucket.
+type RateLimiter struct {
+	ratePerSecond float64
+	burst         float64
+	perClient     bool
+	now           func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func NewRateLimiter(ratePerMinute int, burst int, perClient bool) *RateLimiter {
+
+	return &RateLimiter{
+		ratePerSecond: float64(ratePerMinute) / 60,
+		burst:         float64(burst),
+		perClient:     perClient,
+		now:           time.Now,
+		buckets:       make(map[string]*tokenBucket),
+	}
+}
+
+// Take a token from the bucket identified by `key`
+//
+// If the bucket is empty, the returned duration is how long the caller should wait before trying again.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	if !l.perClient {
+		key = ""
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		l.prune(now)
+		b = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	// refill the bucket based on the time elapsed since it was last used
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.ratePerSecond)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.ratePerSecond <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / l.ratePerSecond * float64(time.Second))
+	return false, wait
+}
+
+// drop buckets that would be full by now; these clients are indistinguishable from new ones
+func (l *RateLimiter) prune(now time.Time) {
+	if len(l.buckets) < MAX_TRACKED_CLIENTS {
+		return
+	}
+
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.lastSeen).Seconds()*l.ratePerSecond >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Wrap `next` so that requests exceeding the configured rate receive a 429 response
+func (l *RateLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.Allow(clientIP(r))
+		if !ok {
+			// Retry-After is expressed in whole seconds; always round up so the client doesn't retry too early
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			msg := "Too many requests: try again later"
+			writeJsonError(w, http.StatusTooManyRequests, ERR_RATE_LIMITED, msg)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// derive the client's IP address from the request, falling back to the raw remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// drive a limiter past its burst and confirm subsequent requests are rejected until tokens refill
+func TestRateLimiterMiddleware(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := NewRateLimiter(6, 3, true)
+	l.now = func() time.Time { return now }
+
+	handler := l.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// the full burst should be allowed through
+	for i := 0; i < 3; i++ {
+		if rr := send("10.0.0.1:5000"); rr.Code != http.StatusOK {
+			t.Fatalf("request %v within burst was rejected: got %v", i, rr.Code)
+		}
+	}
+
+	// the next request exceeds the burst
+	rr := send("10.0.0.1:5001")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("request past burst: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	// 6 per minute means one token every 10 seconds
+	if ra := rr.Header().Get("Retry-After"); ra != "10" {
+		t.Errorf("unexpected Retry-After header: got %q want %q", ra, "10")
+	}
+
+	// a different client has its own bucket
+	if rr := send("10.0.0.2:5000"); rr.Code != http.StatusOK {
+		t.Errorf("request from a second client was rejected: got %v", rr.Code)
+	}
+
+	// after waiting for a token to refill, the first client may send one more request
+	now = now.Add(10 * time.Second)
+	if rr := send("10.0.0.1:5000"); rr.Code != http.StatusOK {
+		t.Errorf("request after refill was rejected: got %v", rr.Code)
+	}
+	if rr := send("10.0.0.1:5000"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("second request after refill: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+// a global limiter shares one bucket across all clients
+func TestRateLimiterGlobal(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := NewRateLimiter(60, 2, false)
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.Allow("10.0.0.1"); !ok {
+		t.Error("first request was rejected")
+	}
+	if ok, _ := l.Allow("10.0.0.2"); !ok {
+		t.Error("second request was rejected")
+	}
+	if ok, wait := l.Allow("10.0.0.3"); ok || wait != time.Second {
+		t.Errorf("third request: got allowed=%v wait=%v, want allowed=false wait=1s", ok, wait)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// incoming request IDs longer than this are replaced rather than echoed back
+const MAX_REQUEST_ID_SIZE = 128
+
+type requestIdKey struct{}
+
+// Tag every request with a correlation ID, taken from the `X-Request-ID` header or generated if absent
+//
+// The ID is stored in the request context and echoed back in the `X-Request-ID` response header.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !isValidRequestId(id) {
+			id = newRequestId()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)))
+	})
+}
+
+// Get the correlation ID of the request the context belongs to; returns "" if there isn't one
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// the ID is echoed into logs and headers, so only accept short strings of printable ASCII
+func isValidRequestId(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_SIZE {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// generate a random (version 4) UUID
+func newRequestId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms; an empty ID is better than no response
+		return ""
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
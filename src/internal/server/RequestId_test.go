@@ -0,0 +1,56 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"src/internal/server"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// the request ID should round-trip from the request header, through the context, to the response header
+func TestRequestIdMiddleware(t *testing.T) {
+	var seen string
+	handler := server.RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = server.RequestIdFromContext(r.Context())
+	}))
+
+	send := func(requestId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if requestId != "" {
+			req.Header.Set("X-Request-ID", requestId)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a provided ID is echoed back
+	rr := send("abc-123")
+	if got := rr.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("unexpected response X-Request-ID: got %q want %q", got, "abc-123")
+	}
+	if seen != "abc-123" {
+		t.Errorf("unexpected request ID in context: got %q want %q", seen, "abc-123")
+	}
+
+	// a missing ID is generated
+	rr = send("")
+	if got := rr.Header().Get("X-Request-ID"); !uuidPattern.MatchString(got) {
+		t.Errorf("generated X-Request-ID is not a UUID: %q", got)
+	}
+	if seen != rr.Header().Get("X-Request-ID") {
+		t.Errorf("request ID in context doesn't match the response header: got %q want %q", seen, rr.Header().Get("X-Request-ID"))
+	}
+
+	// unreasonable IDs are replaced rather than echoed into logs and headers
+	for _, bad := range []string{"has spaces", strings.Repeat("a", 129)} {
+		rr = send(bad)
+		if got := rr.Header().Get("X-Request-ID"); !uuidPattern.MatchString(got) {
+			t.Errorf("invalid X-Request-ID %q was not replaced: got %q", bad, got)
+		}
+	}
+}
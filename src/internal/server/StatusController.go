@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// the spool directory check writes a file; reusing its result for a while stops anonymous callers causing writes at will
+const SPOOL_CHECK_TTL = 10 * time.Second
+
+type StatusResponseBody struct {
+	Status string `json:"status"`
+	// only set when the service can't print
+	Code    string      `json:"code,omitempty"`
+	Printer string      `json:"printer"`
+	Version string      `json:"version"`
+	Spool   SpoolStatus `json:"spool"`
+}
+
+type SpoolStatus struct {
+	Dir      string `json:"dir"`
+	Writable bool   `json:"writable"`
+	// omitted when the free space couldn't be determined
+	FreeBytes *uint64 `json:"freeBytes,omitempty"`
+}
+
+// Reports the state of the resources printing depends on, so a full or read-only disk is noticed before prints start failing
+type StatusController struct {
+	printerName   string
+	version       string
+	spoolDir      string
+	checkSpoolDir func(dir string) error
+	freeDiskSpace func(dir string) (uint64, error)
+	logger        Logger
+
+	mu sync.Mutex
+	// when the spool directory was last checked, and the result
+	spoolCheckedAt time.Time
+	spoolErr       error
+}
+
+func NewStatusController(printerName string, version string, spoolDir string, checkSpoolDir func(dir string) error, freeDiskSpace func(dir string) (uint64, error), logger Logger) *StatusController {
+
+	return &StatusController{
+		printerName:   printerName,
+		version:       version,
+		spoolDir:      spoolDir,
+		checkSpoolDir: checkSpoolDir,
+		freeDiskSpace: freeDiskSpace,
+		logger:        logger,
+	}
+}
+
+// Report the printer name, server version and spool directory status; responds with a 503 if the spool directory can't be written to
+func (c *StatusController) CheckStatusHandler(w http.ResponseWriter, r *http.Request) {
+
+	// this is an informational endpoint; only allow GET
+	if r.Method != "GET" {
+		msg := "This endpoint only supports GET requests"
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return
+	}
+
+	res := StatusResponseBody{
+		Status:  "success",
+		Printer: c.printerName,
+		Version: c.version,
+		Spool:   SpoolStatus{Dir: c.spoolDir, Writable: true},
+	}
+	statusCode := http.StatusOK
+
+	if err := c.spoolDirStatus(r); err != nil {
+		res.Status, res.Code, res.Spool.Writable = "error", ERR_SPOOL_UNAVAILABLE, false
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	// free space is informational; failing to read it doesn't stop printing
+	if free, err := c.freeDiskSpace(c.spoolDir); err != nil {
+		c.logger.Error(r.Context(), "unable to determine free disk space", "dir", c.spoolDir, "err", err)
+	} else {
+		res.Spool.FreeBytes = &free
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
+
+// check the spool directory, reusing the last result if it's less than `SPOOL_CHECK_TTL` old; failures are logged when found
+func (c *StatusController) spoolDirStatus(r *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.spoolCheckedAt.IsZero() && time.Since(c.spoolCheckedAt) < SPOOL_CHECK_TTL {
+		return c.spoolErr
+	}
+
+	c.spoolErr, c.spoolCheckedAt = c.checkSpoolDir(c.spoolDir), time.Now()
+	if c.spoolErr != nil {
+		c.logger.Error(r.Context(), "spool directory check failed", "dir", c.spoolDir, "err", c.spoolErr)
+	}
+
+	return c.spoolErr
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"src/internal/server"
+	"src/internal/utils"
+	"testing"
+)
+
+// Validate the functioning of the `/status` endpoint with a healthy and an unwritable spool directory
+func TestCheckStatusHandler(t *testing.T) {
+	var spoolDir string
+	checks := 0
+	checkSpoolDir := func(dir string) error {
+		spoolDir, checks = dir, checks+1
+		return nil
+	}
+	freeDiskSpace := func(dir string) (uint64, error) { return 1048576, nil }
+
+	var healthyRequests = []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "POST",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports GET requests","code":"method_not_allowed"}`,
+		},
+		// should pass
+		{
+			ReqMethod:           "GET",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedMessage:     `{"status":"success","printer":"dymo","version":"v1.2.3","spool":{"dir":"/var/spool/labels","writable":true,"freeBytes":1048576}}`,
+			ExpectedContentType: "application/json",
+		},
+		// should pass using the result of the previous check
+		{
+			ReqMethod:           "GET",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedMessage:     `{"status":"success","printer":"dymo","version":"v1.2.3","spool":{"dir":"/var/spool/labels","writable":true,"freeBytes":1048576}}`,
+			ExpectedContentType: "application/json",
+		},
+	}
+
+	c := server.NewStatusController("dymo", "v1.2.3", "/var/spool/labels", checkSpoolDir, freeDiskSpace, &utils.MockLogger{})
+	utils.RequestTester(t, healthyRequests, c.CheckStatusHandler)
+
+	if spoolDir != "/var/spool/labels" {
+		t.Errorf("spool directory check was given %q", spoolDir)
+	}
+	// the check writes to the spool directory, so repeated requests mustn't run it every time
+	if checks != 1 {
+		t.Errorf("expected the spool directory to be checked once, got %v checks", checks)
+	}
+
+	var unwritableRequests = []utils.RequestParams{
+		// should fail because the spool directory can't be written to; free space is omitted when it can't be read
+		{
+			ReqMethod:          "GET",
+			ExpectedStatusCode: http.StatusServiceUnavailable,
+			ExpectedMessage:    `{"status":"error","code":"spool_unavailable","printer":"dymo","version":"v1.2.3","spool":{"dir":"/var/spool/labels","writable":false}}`,
+		},
+	}
+
+	logger := &utils.MockLogger{}
+	c = server.NewStatusController("dymo", "v1.2.3", "/var/spool/labels",
+		func(dir string) error { return errors.New("read-only file system") },
+		func(dir string) (uint64, error) { return 0, errors.New("no such file or directory") },
+		logger,
+	)
+	utils.RequestTester(t, unwritableRequests, c.CheckStatusHandler)
+
+	if len(logger.Entries) != 2 {
+		t.Errorf("expected both failed checks to be logged, got %+v", logger.Entries)
+	}
+}
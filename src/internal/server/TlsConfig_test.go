@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"src/internal/server"
+	"testing"
+	"time"
+)
+
+func TestNewTlsConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	// plain HTTP when neither file is set
+	c, err := server.NewTlsConfig("", "")
+	if err != nil || c != nil {
+		t.Errorf("expected no TLS config and no error, got %v, %v", c, err)
+	}
+
+	// should fail because only one of the files is set
+	if _, err := server.NewTlsConfig(certFile, ""); err == nil {
+		t.Error("expected an error when only the certificate is set")
+	}
+	if _, err := server.NewTlsConfig("", keyFile); err == nil {
+		t.Error("expected an error when only the key is set")
+	}
+
+	// should fail because the files can't be loaded
+	if _, err := server.NewTlsConfig(certFile, filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("expected an error when the key file doesn't exist")
+	}
+	if _, err := server.NewTlsConfig(keyFile, certFile); err == nil {
+		t.Error("expected an error when the certificate and key are swapped")
+	}
+
+	// should pass with both files
+	c, err = server.NewTlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", c.MinVersion)
+	}
+	if len(c.Certificates) != 1 {
+		t.Errorf("expected 1 certificate, got %v", len(c.Certificates))
+	}
+}
+
+// write a self-signed certificate and its key to a temporary directory
+func writeTestCertificate(t *testing.T) (certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
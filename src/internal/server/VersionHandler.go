@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"src/internal/buildinfo"
+)
+
+type VersionResponseBody struct {
+	Status string `json:"status"`
+	buildinfo.Info
+}
+
+// Report which build of the server is running: its version, git commit, build date and Go version
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+
+	// this is an informational endpoint; only allow GET
+	if r.Method != "GET" {
+		msg := "This endpoint only supports GET requests"
+		writeJsonError(w, http.StatusBadRequest, ERR_METHOD_NOT_ALLOWED, msg)
+		return
+	}
+
+	b, err := json.Marshal(VersionResponseBody{Status: "success", Info: buildinfo.Get()})
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, ERR_INTERNAL, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,38 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"src/internal/server"
+	"src/internal/utils"
+	"testing"
+)
+
+// every build detail should be reported, falling back to placeholders when the build didn't set them
+func TestVersionHandler(t *testing.T) {
+	utils.RequestTester(t, []utils.RequestParams{
+		// should fail because incorrect HTTP method
+		{
+			ReqMethod:          "POST",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedMessage:    `{"status":"error","message":"This endpoint only supports GET requests","code":"method_not_allowed"}`,
+		},
+	}, server.VersionHandler)
+
+	rr := httptest.NewRecorder()
+	server.VersionHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+
+	var res map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	for _, field := range []string{"status", "version", "commit", "buildDate", "goVersion"} {
+		if res[field] == "" {
+			t.Errorf("response is missing %v: %v", field, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Configuration for the backend server, read from environment variables
+//
+// Every setting is optional; `LoadFromEnv` fills in the defaults below and fails on values that can't be used.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"src/internal/pdf"
+	"src/internal/system"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_LISTEN_ADDRESS = ":4000"
+	DEFAULT_SPOOL_DIR      = "./tmp"
+
+	// the label itself can only display a few words, so 128 bytes is more than enough for a reasonable request
+	// yet it is small enough to very quickly recognize if the request is unreasonably large.
+	// Deployments whose clients use the optional fields (printer, orientation, colors, print options) should raise it
+	DEFAULT_MAX_REQUEST_BODY_SIZE = 128
+	// counted in characters, like the label text limit
+	MAX_DATE_DESCRIPTOR_LENGTH = 20
+	// roughly the number of average-width characters that fit on one line of the label in the title font;
+	// anything longer runs off the edge of the label
+	DEFAULT_MAX_LABEL_TEXT_LENGTH = 18
+	// a roll of leftover labels holds a few hundred; more than this in one go is almost certainly a mistake
+	DEFAULT_MAX_LABEL_QUANTITY = 50
+
+	DEFAULT_READ_TIMEOUT  = 10 * time.Second
+	DEFAULT_WRITE_TIMEOUT = 10 * time.Second
+	// net/http falls back to the read timeout for idle keep-alive connections when none is set
+	DEFAULT_IDLE_TIMEOUT = DEFAULT_READ_TIMEOUT
+
+	// a label printer handles one job at a time; a couple in flight keeps it busy without flooding the CUPS queue
+	DEFAULT_MAX_CONCURRENT_PRINTS = 2
+	DEFAULT_PRINT_QUEUE_TIMEOUT   = 2 * time.Second
+	// jobs waiting their turn at a printer; the queue can only fill up when MAX_CONCURRENT_PRINTS is larger than this
+	DEFAULT_PRINT_QUEUE_SIZE = 4
+	// handing a job to CUPS takes well under a second; give up before the server's 10s write timeout cuts the response off
+	DEFAULT_PRINT_TIMEOUT = 5 * time.Second
+	// print jobs are abandoned this long before the write timeout, leaving time to tell the client how far they got
+	WRITE_TIMEOUT_MARGIN = 500 * time.Millisecond
+
+	DEFAULT_RATE_LIMIT_PER_MINUTE  = 30
+	DEFAULT_RATE_LIMIT_BURST       = 10
+	DEFAULT_IDEMPOTENCY_CACHE_SIZE = 100
+	DEFAULT_IDEMPOTENCY_TTL        = 10 * time.Minute
+	DEFAULT_JOB_HISTORY_SIZE       = 50
+)
+
+type Config struct {
+	/* SERVER */
+	ListenAddress string
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	IdleTimeout   time.Duration
+	// both empty to serve plain HTTP
+	TlsCertFile string
+	TlsKeyFile  string
+	// empty to leave CORS disabled
+	CorsAllowedOrigins []string
+	CorsAllowedMethods string
+	CorsAllowedHeaders string
+
+	/* PRINTING */
+	SpoolDir            string
+	PrinterName         string
+	AllowedPrinters     []string
+	PrintBackend        string
+	MaxConcurrentPrints int
+	PrintQueueTimeout   time.Duration
+	PrintQueueSize      int
+	PrintTimeout        time.Duration
+	CutBetweenCopies    bool
+
+	/* REQUESTS */
+	// empty to accept unauthenticated print requests
+	ApiKey                string
+	MaxRequestBodySize    int
+	MaxLabelTextLength    int
+	MaxLabelQuantity      int
+	DefaultDateDescriptor string
+	// the date layout and timezone used on every label
+	LabelOptions         pdf.Options
+	RateLimitPerMinute   int
+	RateLimitBurst       int
+	RateLimitPerClient   bool
+	IdempotencyCacheSize int
+	IdempotencyTtl       time.Duration
+	JobHistorySize       int
+}
+
+// Read the configuration from the environment, applying defaults for unset variables
+//
+// Fails with an error naming the variable if any value is invalid.
+func LoadFromEnv() (Config, error) {
+	c := Config{
+		ListenAddress:         stringFromEnv("LISTEN_ADDRESS", DEFAULT_LISTEN_ADDRESS),
+		TlsCertFile:           os.Getenv("TLS_CERT_FILE"),
+		TlsKeyFile:            os.Getenv("TLS_KEY_FILE"),
+		CorsAllowedMethods:    os.Getenv("CORS_ALLOWED_METHODS"),
+		CorsAllowedHeaders:    os.Getenv("CORS_ALLOWED_HEADERS"),
+		SpoolDir:              stringFromEnv("SPOOL_DIR", DEFAULT_SPOOL_DIR),
+		PrinterName:           stringFromEnv("PRINTER_NAME", system.DEFAULT_PRINTER_NAME),
+		PrintBackend:          stringFromEnv("PRINT_BACKEND", system.BACKEND_LP),
+		ApiKey:                os.Getenv("API_KEY"),
+		DefaultDateDescriptor: stringFromEnv("DEFAULT_DATE_DESCRIPTOR", pdf.DEFAULT_DATE_DESCRIPTOR),
+	}
+
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		c.CorsAllowedOrigins = strings.Split(origins, ",")
+	}
+
+	if printers := os.Getenv("ALLOWED_PRINTERS"); printers != "" {
+		for _, p := range strings.Split(printers, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.AllowedPrinters = append(c.AllowedPrinters, p)
+			}
+		}
+	}
+
+	env := &envReader{}
+	c.ReadTimeout = env.duration("READ_TIMEOUT", DEFAULT_READ_TIMEOUT)
+	c.WriteTimeout = env.duration("WRITE_TIMEOUT", DEFAULT_WRITE_TIMEOUT)
+	c.IdleTimeout = env.duration("IDLE_TIMEOUT", DEFAULT_IDLE_TIMEOUT)
+	c.MaxConcurrentPrints = env.int("MAX_CONCURRENT_PRINTS", DEFAULT_MAX_CONCURRENT_PRINTS)
+	c.PrintQueueTimeout = env.duration("PRINT_QUEUE_TIMEOUT", DEFAULT_PRINT_QUEUE_TIMEOUT)
+	c.PrintQueueSize = env.int("PRINT_QUEUE_SIZE", DEFAULT_PRINT_QUEUE_SIZE)
+	c.PrintTimeout = env.duration("PRINT_TIMEOUT", DEFAULT_PRINT_TIMEOUT)
+	c.CutBetweenCopies = env.bool("CUT_BETWEEN_COPIES", false)
+	c.MaxRequestBodySize = env.int("MAX_REQUEST_BODY_SIZE", DEFAULT_MAX_REQUEST_BODY_SIZE)
+	c.MaxLabelTextLength = env.int("MAX_LABEL_TEXT_LENGTH", DEFAULT_MAX_LABEL_TEXT_LENGTH)
+	c.MaxLabelQuantity = env.int("MAX_LABEL_QUANTITY", DEFAULT_MAX_LABEL_QUANTITY)
+	c.RateLimitPerMinute = env.int("RATE_LIMIT_PER_MINUTE", DEFAULT_RATE_LIMIT_PER_MINUTE)
+	c.RateLimitBurst = env.int("RATE_LIMIT_BURST", DEFAULT_RATE_LIMIT_BURST)
+	c.IdempotencyCacheSize = env.int("IDEMPOTENCY_CACHE_SIZE", DEFAULT_IDEMPOTENCY_CACHE_SIZE)
+	c.IdempotencyTtl = env.duration("IDEMPOTENCY_TTL", DEFAULT_IDEMPOTENCY_TTL)
+	c.JobHistorySize = env.int("JOB_HISTORY_SIZE", DEFAULT_JOB_HISTORY_SIZE)
+
+	switch scope := os.Getenv("RATE_LIMIT_SCOPE"); scope {
+	case "", "ip":
+		c.RateLimitPerClient = true
+	case "global":
+		c.RateLimitPerClient = false
+	default:
+		env.fail(fmt.Errorf("invalid value for RATE_LIMIT_SCOPE: %q (must be \"ip\" or \"global\")", scope))
+	}
+
+	if c.PrintBackend != system.BACKEND_LP && c.PrintBackend != system.BACKEND_LPR {
+		env.fail(fmt.Errorf("invalid value for PRINT_BACKEND: %q (must be %q or %q)", c.PrintBackend, system.BACKEND_LP, system.BACKEND_LPR))
+	}
+	if err := system.ValidatePrinterName(c.PrinterName); err != nil {
+		env.fail(fmt.Errorf("invalid value for PRINTER_NAME: %w", err))
+	}
+	for _, p := range c.AllowedPrinters {
+		if err := system.ValidatePrinterName(p); err != nil {
+			env.fail(fmt.Errorf("invalid value for ALLOWED_PRINTERS: %w", err))
+		}
+	}
+
+	// a print command that outlives the write timeout would leave the client without a response
+	if c.PrintTimeout > c.WriteTimeout-WRITE_TIMEOUT_MARGIN {
+		env.fail(fmt.Errorf("invalid value for PRINT_TIMEOUT: %v (must be at least %v shorter than WRITE_TIMEOUT, %v)", c.PrintTimeout, WRITE_TIMEOUT_MARGIN, c.WriteTimeout))
+	}
+
+	if (c.TlsCertFile == "") != (c.TlsKeyFile == "") {
+		env.fail(errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	// the default is used whenever a request omits dateDescriptor, so it gets the same checks as request input
+	if utf8.RuneCountInString(c.DefaultDateDescriptor) > MAX_DATE_DESCRIPTOR_LENGTH {
+		env.fail(fmt.Errorf("invalid value for DEFAULT_DATE_DESCRIPTOR: %q (longer than %v characters)", c.DefaultDateDescriptor, MAX_DATE_DESCRIPTOR_LENGTH))
+	} else if err := pdf.ValidateDateDescriptor(c.DefaultDateDescriptor, c.LabelOptions.Fonts); err != nil {
+		env.fail(fmt.Errorf("invalid value for DEFAULT_DATE_DESCRIPTOR: %q (%v)", c.DefaultDateDescriptor, err))
+	}
+
+	c.LabelOptions.DateLayout = os.Getenv("LABEL_DATE_LAYOUT")
+	if tz := os.Getenv("LABEL_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			env.fail(fmt.Errorf("invalid value for LABEL_TIMEZONE: %q (%v)", tz, err))
+		}
+		c.LabelOptions.Location = loc
+	}
+	if _, err := c.LabelOptions.FormattedDate(); err != nil {
+		env.fail(fmt.Errorf("invalid value for LABEL_DATE_LAYOUT: %v", err))
+	}
+
+	// report every invalid variable at once rather than one per restart
+	if len(env.errs) > 0 {
+		return Config{}, errors.Join(env.errs...)
+	}
+
+	return c, nil
+}
+
+// read a string from the environment, falling back to `fallback` if unset
+func stringFromEnv(name string, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// reads typed values from the environment, remembering every invalid one
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) fail(err error) {
+	e.errs = append(e.errs, err)
+}
+
+// read a positive integer from the environment, falling back to `fallback` if unset
+func (e *envReader) int(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		e.fail(fmt.Errorf("invalid value for %v: %q (must be a positive integer)", name, v))
+		return fallback
+	}
+
+	return i
+}
+
+// read a boolean ("true", "false", "1", "0", ...) from the environment, falling back to `fallback` if unset
+func (e *envReader) bool(name string, fallback bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(fmt.Errorf("invalid value for %v: %q (must be true or false)", name, v))
+		return fallback
+	}
+
+	return b
+}
+
+// read a positive duration (e.g. "90s", "10m") from the environment, falling back to `fallback` if unset
+func (e *envReader) duration(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		e.fail(fmt.Errorf("invalid value for %v: %q (must be a positive duration)", name, v))
+		return fallback
+	}
+
+	return d
+}
@@ -0,0 +1,154 @@
+package config_test
+
+import (
+	"src/internal/server/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// every variable read by LoadFromEnv; cleared before each test so the host environment can't leak in
+var variables = []string{
+	"LISTEN_ADDRESS", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "TLS_CERT_FILE", "TLS_KEY_FILE",
+	"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS",
+	"SPOOL_DIR", "PRINTER_NAME", "ALLOWED_PRINTERS", "PRINT_BACKEND", "MAX_CONCURRENT_PRINTS", "PRINT_QUEUE_TIMEOUT", "PRINT_QUEUE_SIZE", "PRINT_TIMEOUT", "CUT_BETWEEN_COPIES",
+	"API_KEY", "MAX_REQUEST_BODY_SIZE", "MAX_LABEL_TEXT_LENGTH", "MAX_LABEL_QUANTITY", "DEFAULT_DATE_DESCRIPTOR", "LABEL_DATE_LAYOUT", "LABEL_TIMEZONE",
+	"RATE_LIMIT_PER_MINUTE", "RATE_LIMIT_BURST", "RATE_LIMIT_SCOPE", "IDEMPOTENCY_CACHE_SIZE", "IDEMPOTENCY_TTL", "JOB_HISTORY_SIZE",
+}
+
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, name := range variables {
+		t.Setenv(name, env[name])
+	}
+}
+
+func TestLoadFromEnv_Defaults(t *testing.T) {
+	setEnv(t, nil)
+
+	c, err := config.LoadFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.ListenAddress != ":4000" || c.SpoolDir != "./tmp" || c.PrinterName != "dymo" || c.PrintBackend != "lp" {
+		t.Errorf("unexpected defaults: listen=%q spool=%q printer=%q backend=%q", c.ListenAddress, c.SpoolDir, c.PrinterName, c.PrintBackend)
+	}
+	if c.ReadTimeout != 10*time.Second || c.WriteTimeout != 10*time.Second || c.IdleTimeout != 10*time.Second {
+		t.Errorf("unexpected default timeouts: read=%v write=%v idle=%v", c.ReadTimeout, c.WriteTimeout, c.IdleTimeout)
+	}
+	if c.MaxRequestBodySize != 128 || c.MaxLabelTextLength != 18 || c.MaxLabelQuantity != 50 || c.DefaultDateDescriptor != "made:" {
+		t.Errorf("unexpected default request limits: body=%v text=%v quantity=%v descriptor=%q", c.MaxRequestBodySize, c.MaxLabelTextLength, c.MaxLabelQuantity, c.DefaultDateDescriptor)
+	}
+	if !c.RateLimitPerClient || c.RateLimitPerMinute != 30 || c.RateLimitBurst != 10 {
+		t.Errorf("unexpected default rate limit: perClient=%v perMinute=%v burst=%v", c.RateLimitPerClient, c.RateLimitPerMinute, c.RateLimitBurst)
+	}
+	if c.ApiKey != "" || c.CutBetweenCopies || c.TlsCertFile != "" || c.CorsAllowedOrigins != nil || c.LabelOptions.Location != nil {
+		t.Errorf("optional features should be off by default: %+v", c)
+	}
+}
+
+func TestLoadFromEnv_Overrides(t *testing.T) {
+	setEnv(t, map[string]string{
+		"LISTEN_ADDRESS":        "127.0.0.1:8080",
+		"READ_TIMEOUT":          "5s",
+		"WRITE_TIMEOUT":         "30s",
+		"IDLE_TIMEOUT":          "2m",
+		"SPOOL_DIR":             "/var/spool/labels",
+		"PRINTER_NAME":          "zebra_2",
+		"ALLOWED_PRINTERS":      "dymo, zebra_3",
+		"PRINT_BACKEND":         "lpr",
+		"CUT_BETWEEN_COPIES":    "true",
+		"MAX_REQUEST_BODY_SIZE": "512",
+		"MAX_LABEL_QUANTITY":    "10",
+		"CORS_ALLOWED_ORIGINS":  "https://a.example.com,https://b.example.com",
+		"RATE_LIMIT_SCOPE":      "global",
+		"LABEL_TIMEZONE":        "America/Chicago",
+	})
+
+	c, err := config.LoadFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.ListenAddress != "127.0.0.1:8080" || c.SpoolDir != "/var/spool/labels" || c.PrinterName != "zebra_2" || c.PrintBackend != "lpr" {
+		t.Errorf("unexpected values: listen=%q spool=%q printer=%q backend=%q", c.ListenAddress, c.SpoolDir, c.PrinterName, c.PrintBackend)
+	}
+	if c.ReadTimeout != 5*time.Second || c.WriteTimeout != 30*time.Second || c.IdleTimeout != 2*time.Minute {
+		t.Errorf("unexpected timeouts: read=%v write=%v idle=%v", c.ReadTimeout, c.WriteTimeout, c.IdleTimeout)
+	}
+	if len(c.AllowedPrinters) != 2 || c.AllowedPrinters[0] != "dymo" || c.AllowedPrinters[1] != "zebra_3" {
+		t.Errorf("unexpected allowed printers: %q", c.AllowedPrinters)
+	}
+	if !c.CutBetweenCopies {
+		t.Error("expected CUT_BETWEEN_COPIES to be enabled")
+	}
+	if c.MaxRequestBodySize != 512 || c.MaxLabelQuantity != 10 {
+		t.Errorf("unexpected request limits: body=%v quantity=%v", c.MaxRequestBodySize, c.MaxLabelQuantity)
+	}
+	if len(c.CorsAllowedOrigins) != 2 || c.RateLimitPerClient {
+		t.Errorf("unexpected CORS origins or rate limit scope: %v %v", c.CorsAllowedOrigins, c.RateLimitPerClient)
+	}
+	if c.LabelOptions.Location == nil || c.LabelOptions.Location.String() != "America/Chicago" {
+		t.Errorf("unexpected label timezone: %v", c.LabelOptions.Location)
+	}
+}
+
+// every invalid variable should be named in the error, not just the first
+func TestLoadFromEnv_Invalid(t *testing.T) {
+	setEnv(t, map[string]string{
+		"READ_TIMEOUT":            "soon",
+		"IDLE_TIMEOUT":            "-1s",
+		"MAX_REQUEST_BODY_SIZE":   "0",
+		"RATE_LIMIT_BURST":        "lots",
+		"RATE_LIMIT_SCOPE":        "planet",
+		"PRINT_BACKEND":           "cat",
+		"CUT_BETWEEN_COPIES":      "sometimes",
+		"PRINT_TIMEOUT":           "10s",
+		"PRINTER_NAME":            "-o evil",
+		"ALLOWED_PRINTERS":        "dymo,$(reboot)",
+		"TLS_CERT_FILE":           "/etc/cert.pem",
+		"DEFAULT_DATE_DESCRIPTOR": "this descriptor is far too long",
+		"LABEL_TIMEZONE":          "Mars/Olympus_Mons",
+	})
+
+	_, err := config.LoadFromEnv()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, name := range []string{"READ_TIMEOUT", "IDLE_TIMEOUT", "MAX_REQUEST_BODY_SIZE", "RATE_LIMIT_BURST", "RATE_LIMIT_SCOPE", "PRINT_BACKEND", "CUT_BETWEEN_COPIES", "PRINT_TIMEOUT", "PRINTER_NAME", "ALLOWED_PRINTERS", "TLS_CERT_FILE", "DEFAULT_DATE_DESCRIPTOR", "LABEL_TIMEZONE"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error doesn't mention %v: %v", name, err)
+		}
+	}
+}
+
+// the default descriptor is printed on every label that omits one, so it's held to the same rules as request input
+func TestLoadFromEnv_DefaultDateDescriptor(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"frozen:", true},
+		// the limit is in characters, not bytes
+		{strings.Repeat("é", 20), true},
+		{strings.Repeat("é", 21), false},
+		{"made:\t", false},
+		{"made\u200b:", false},
+		// no glyph in the body font
+		{"soup 🍲", false},
+	}
+
+	for _, tt := range tests {
+		setEnv(t, map[string]string{"DEFAULT_DATE_DESCRIPTOR": tt.value})
+
+		_, err := config.LoadFromEnv()
+		if tt.valid && err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.value, err)
+		}
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "DEFAULT_DATE_DESCRIPTOR")) {
+			t.Errorf("%q: expected a DEFAULT_DATE_DESCRIPTOR error, got %v", tt.value, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// machine-readable error codes returned in the `code` field of error responses
+//
+// These values are part of the API contract: clients may switch on them, so don't rename them.
+const (
+	ERR_METHOD_NOT_ALLOWED       = "method_not_allowed"
+	ERR_UNSUPPORTED_MEDIA_TYPE   = "unsupported_media_type"
+	ERR_MISSING_BODY             = "missing_body"
+	ERR_BODY_TOO_LARGE           = "body_too_large"
+	ERR_UNKNOWN_FIELD            = "unknown_field"
+	ERR_MALFORMED_BODY           = "malformed_body"
+	ERR_MISSING_LABEL_TEXT       = "missing_label_text"
+	ERR_LABEL_TEXT_TOO_LONG      = "label_text_too_long"
+	ERR_UNSUPPORTED_CHARACTERS   = "unsupported_characters"
+	ERR_INVALID_CHARACTERS       = "invalid_characters"
+	ERR_INVALID_QUANTITY         = "invalid_quantity"
+	ERR_QUANTITY_TOO_LARGE       = "quantity_too_large"
+	ERR_DATE_DESCRIPTOR_TOO_LONG = "date_descriptor_too_long"
+	ERR_INVALID_SHELF_LIFE       = "invalid_shelf_life"
+	ERR_INVALID_PRINT_OPTION     = "invalid_print_option"
+	ERR_UNKNOWN_PRINTER          = "unknown_printer"
+	ERR_INVALID_ORIENTATION      = "invalid_orientation"
+	ERR_INVALID_COLOR            = "invalid_color"
+	ERR_PDF_GENERATION_FAILED    = "pdf_generation_failed"
+	ERR_PRINT_FAILED             = "print_failed"
+	ERR_PRINT_TIMEOUT            = "print_timeout"
+	ERR_INTERNAL                 = "internal_error"
+	ERR_UNAUTHORIZED             = "unauthorized"
+	ERR_RATE_LIMITED             = "rate_limited"
+	ERR_PRINTER_UNAVAILABLE      = "printer_unavailable"
+	ERR_PRINTER_BUSY             = "printer_busy"
+	ERR_SPOOL_UNAVAILABLE        = "spool_unavailable"
+	ERR_INVALID_IDEMPOTENCY_KEY  = "invalid_idempotency_key"
+	ERR_IDEMPOTENCY_KEY_REUSED   = "idempotency_key_reused"
+)
+
+type ErrorResponseBody struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Code    string `json:"code"`
+	// every invalid field in the request; only set for validation failures
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// A problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// Write a JSON error response in the shape `{"status":"error","message":"...","code":"..."}`
+func writeJsonError(w http.ResponseWriter, statusCode int, code string, msg string) {
+	b, err := json.Marshal(ErrorResponseBody{Status: "error", Message: msg, Code: code})
+	if err != nil {
+		// marshalling a struct of strings can't realistically fail, but never leave the client without a response
+		http.Error(w, msg, statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
+
+// Write a 400 response listing every invalid field
+//
+// The first failure also fills the top-level message and code, so clients that only read those keep working.
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	b, err := json.Marshal(ErrorResponseBody{Status: "error", Message: errs[0].Message, Code: errs[0].Code, Errors: errs})
+	if err != nil {
+		http.Error(w, errs[0].Message, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(b)
+}
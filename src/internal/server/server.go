@@ -1,16 +1,88 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"src/internal/buildinfo"
 	"src/internal/pdf"
+	"src/internal/server/config"
 	"src/internal/system"
-	"time"
 )
 
-func InitializeServer() *http.Server {
+func InitializeServer() (*http.Server, error) {
+	/* -- VALIDATE ENVIRONMENT -- */
+	cfg, err := config.LoadFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := system.ValidateSpoolDir(cfg.SpoolDir); err != nil {
+		return nil, err
+	}
+
+	// a bad build should fail here rather than on the first print
+	if err := pdf.ValidateFonts(); err != nil {
+		return nil, err
+	}
+
+	printPdf, err := system.NewPdfPrinter(cfg.PrintBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	// serve HTTPS when a certificate is configured; otherwise plain HTTP
+	tlsConfig, err := NewTlsConfig(cfg.TlsCertFile, cfg.TlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
 	/* -- INITIALIZE CONTROLLERS -- */
-	healthController := HealthController{}
-	printController := NewPrintLeftoverLabelController(pdf.GeneratePdf, system.PrintPdf)
+	logger := NewStdLogger()
+	jobHistory := NewJobHistory(cfg.JobHistorySize)
+	healthController := NewHealthController(func(ctx context.Context) error { return system.CheckPrinter(ctx, cfg.PrinterName) }, logger)
+	statusController := NewStatusController(cfg.PrinterName, buildinfo.Version, cfg.SpoolDir, system.ValidateSpoolDir, system.FreeDiskSpace, logger)
+	printController := NewPrintLeftoverLabelController(pdf.GeneratePdfWithOptions, printPdf, PrintLeftoverLabelOptions{
+		DefaultDateDescriptor: cfg.DefaultDateDescriptor,
+		LabelOptions:          cfg.LabelOptions,
+		SpoolDir:              cfg.SpoolDir,
+		PrinterName:           cfg.PrinterName,
+		AllowedPrinters:       cfg.AllowedPrinters,
+		MaxRequestBodySize:    cfg.MaxRequestBodySize,
+		MaxLabelTextLength:    cfg.MaxLabelTextLength,
+		MaxLabelQuantity:      cfg.MaxLabelQuantity,
+		Logger:                logger,
+		MaxConcurrentPrints:   cfg.MaxConcurrentPrints,
+		PrintQueueTimeout:     cfg.PrintQueueTimeout,
+		PrintQueueSize:        cfg.PrintQueueSize,
+		PrintTimeout:          cfg.PrintTimeout,
+		WriteTimeout:          cfg.WriteTimeout,
+		CutBetweenCopies:      cfg.CutBetweenCopies,
+		JobHistory:            jobHistory,
+	})
+
+	/* -- INITIALIZE MIDDLEWARE -- */
+	// limit print requests per client IP unless RATE_LIMIT_SCOPE is "global"
+	printRateLimiter := NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst, cfg.RateLimitPerClient)
+	// previews don't use the printer, so a UI refreshing them as the user types mustn't use up the print allowance
+	previewRateLimiter := NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst, cfg.RateLimitPerClient)
+	// someone checking the printer with test pages shouldn't leave the kitchen unable to print labels
+	testPageRateLimiter := NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst, cfg.RateLimitPerClient)
+
+	// answer repeated requests carrying the same Idempotency-Key without printing again
+	idempotencyCache := NewIdempotencyCache(cfg.IdempotencyCacheSize, cfg.IdempotencyTtl, cfg.MaxRequestBodySize)
+
+	// require an API key for printing (test pages included) and for the job history, which contains label text; health checks remain open for load balancers
+	printHandler := idempotencyCache.Middleware(printController.PrintLeftoverLabelHandler)
+	jobsHandler := jobHistory.ListJobsHandler
+	testPageHandler := printController.PrintTestPageHandler
+	if cfg.ApiKey != "" {
+		authenticator := NewApiKeyAuthenticator(cfg.ApiKey)
+		printHandler = authenticator.Middleware(printHandler)
+		jobsHandler = authenticator.Middleware(jobsHandler)
+		testPageHandler = authenticator.Middleware(testPageHandler)
+	} else {
+		logger.Warn(context.Background(), "API_KEY is not set: the print endpoint will accept unauthenticated requests")
+	}
 
 	/* -- CONFIGURE ROUTING -- */
 	mux := http.NewServeMux()
@@ -18,17 +90,39 @@ func InitializeServer() *http.Server {
 	/* ENDPOINTS */
 	// handle health checks
 	mux.HandleFunc("/api/v1/health", healthController.CheckHealthHandler)
+	// handle readiness checks; unlike health checks, these verify the printer is available
+	mux.HandleFunc("/api/v1/ready", healthController.CheckReadinessHandler)
+	// report which build is deployed
+	mux.HandleFunc("/api/v1/version", VersionHandler)
+	// report the spool directory's status and free disk space, along with the printer name and version
+	mux.HandleFunc("/api/v1/status", statusController.CheckStatusHandler)
 	// handle label print requests
-	mux.HandleFunc("/api/v1/print-leftover-label", printController.PrintLeftoverLabelHandler)
+	mux.HandleFunc("/api/v1/print-leftover-label", printRateLimiter.Middleware(printHandler))
+	// print a diagnostic label to check the printer works end-to-end
+	mux.HandleFunc("/api/v1/print-test-page", testPageRateLimiter.Middleware(testPageHandler))
+	// list recent print jobs and their outcomes, newest first
+	mux.HandleFunc("/api/v1/jobs", jobsHandler)
+	// handle label previews; these don't print, so no API key is required
+	mux.HandleFunc("/api/v1/preview-leftover-label", previewRateLimiter.Middleware(printController.PreviewLeftoverLabelHandler))
+
+	/* MIDDLEWARE */
+	// allow browser front-ends on the listed origins to call the API
+	var handler http.Handler = mux
+	if len(cfg.CorsAllowedOrigins) > 0 {
+		cors := NewCorsPolicy(cfg.CorsAllowedOrigins, cfg.CorsAllowedMethods, cfg.CorsAllowedHeaders)
+		handler = cors.Middleware(mux)
+	}
 
 	/* -- DEFINE SERVER PROPERTIES -- */
 	s := &http.Server{
-		Addr:           ":4000",
-		Handler:        mux,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		Addr:           cfg.ListenAddress,
+		Handler:        RequestIdMiddleware(handler),
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
 		MaxHeaderBytes: 1 << 20,
+		TLSConfig:      tlsConfig,
 	}
 
-	return s
+	return s, nil
 }
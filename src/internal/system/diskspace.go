@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package system
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Report the space available to the server's user on the filesystem holding `dir`, in bytes
+func FreeDiskSpace(dir string) (uint64, error) {
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("unable to read filesystem stats for %v: %w", dir, err)
+	}
+
+	// Bavail excludes blocks reserved for root, which the server can't use
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
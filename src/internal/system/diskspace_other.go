@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package system
+
+import (
+	"errors"
+)
+
+// Report the space available to the server's user on the filesystem holding `dir`, in bytes
+//
+// Only Linux and macOS are supported; elsewhere this always fails.
+func FreeDiskSpace(dir string) (uint64, error) {
+
+	return 0, errors.New("unable to read filesystem stats for " + dir + ": not supported on this platform")
+}
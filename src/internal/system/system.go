@@ -4,25 +4,309 @@
 package system
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
-// use system commands to print document at given filepath
-func PrintPdf(quantity int, filePathName string) ([]byte, error) {
+// name of the CUPS printer that labels are sent to unless another is configured
+const DEFAULT_PRINTER_NAME = "dymo"
 
-	filePathName, err := filepath.Abs(filePathName)
+// supported print commands; both are provided by CUPS, but some systems only ship the BSD-style "lpr"
+const (
+	BACKEND_LP  = "lp"
+	BACKEND_LPR = "lpr"
+)
+
+// A document to print, and how to print it
+type PrintJob struct {
+	FilePathName string
+	Quantity     int
+	// the CUPS printer to print on; defaults to `DEFAULT_PRINTER_NAME`
+	Printer string
+	// extra CUPS options (`-o key=value`), e.g. `media`; see `ValidatePrintOptions`
+	Options map[string]string
+	// print each copy as a job of its own, so a printer that cuts (or feeds, for tearing off) at the end of a job does so between copies
+	CutBetweenCopies bool
+	// how long each print command may run before it is killed; with `CutBetweenCopies` every copy gets this long.
+	// Zero leaves it to the caller's context
+	CopyTimeout time.Duration
+}
+
+// CUPS options that clients may set; anything else could reconfigure the printer or job in unexpected ways
+var allowedPrintOptions = map[string]bool{
+	"Collate":               true,
+	"fit-to-page":           true,
+	"media":                 true,
+	"orientation-requested": true,
+	"print-quality":         true,
+	"print-scaling":         true,
+}
+
+// options sent with every job unless overridden
+var defaultPrintOptions = map[string]string{
+	"Collate":               "True",
+	"orientation-requested": "4", // rotate print by 90°
+}
+
+// lp splits -o values on spaces into several options, so values are limited to a conservative character set
+var printOptionValuePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Get a print function which uses the given backend ("lp" or "lpr")
+//
+// Fails if the backend is unknown or its program can't be found on the PATH. The print function kills the print command
+// if `ctx` is cancelled or its deadline passes before it finishes.
+func NewPdfPrinter(backend string) (func(ctx context.Context, job PrintJob) ([]byte, error), error) {
+
+	if err := ValidatePrintBackend(backend); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, job PrintJob) ([]byte, error) {
+		return printWithBackend(ctx, backend, job)
+	}, nil
+}
+
+// ensure the backend is supported and its program is installed
+func ValidatePrintBackend(backend string) error {
+
+	if backend != BACKEND_LP && backend != BACKEND_LPR {
+		return fmt.Errorf("unsupported print backend %q: must be %q or %q", backend, BACKEND_LP, BACKEND_LPR)
+	}
+
+	if _, err := exec.LookPath(backend); err != nil {
+		return fmt.Errorf("print backend %q is not installed: %w", backend, err)
+	}
+
+	return nil
+}
+
+// CUPS printer names may not contain spaces, tabs, "/", "\\" or "#"; a leading "-" would be read as a flag
+var printerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@][A-Za-z0-9_.@-]{0,126}$`)
+
+// Ensure the name is one CUPS could have given a printer
+func ValidatePrinterName(name string) error {
+
+	if !printerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid printer name %q: use up to 127 letters, digits, '.', '_', '@' or '-'", name)
+	}
+
+	return nil
+}
+
+// Ensure every option is allowed and its value is safe to pass to the print command
+func ValidatePrintOptions(options map[string]string) error {
+
+	for _, k := range sortedKeys(options) {
+		if !allowedPrintOptions[k] {
+			return fmt.Errorf("unsupported print option %q: must be one of %v", k, strings.Join(sortedKeys(allowedPrintOptions), ", "))
+		}
+		if !printOptionValuePattern.MatchString(options[k]) {
+			return fmt.Errorf("invalid value for print option %q: use up to 64 letters, digits, '.', '_' or '-'", k)
+		}
+	}
+
+	return nil
+}
+
+// Build the arguments for printing the job with the given backend
+func PrintCommandArgs(backend string, job PrintJob) ([]string, error) {
+
+	// "lp" and "lpr" accept the same -o options, but name the copies and destination flags differently
+	var copiesFlag, printerFlag string
+	switch backend {
+	case BACKEND_LP:
+		copiesFlag, printerFlag = "-n", "-d"
+	case BACKEND_LPR:
+		copiesFlag, printerFlag = "-#", "-P"
+	default:
+		return nil, fmt.Errorf("unsupported print backend %q", backend)
+	}
+
+	if err := ValidatePrintOptions(job.Options); err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]string, len(defaultPrintOptions)+len(job.Options))
+	for k, v := range defaultPrintOptions {
+		options[k] = v
+	}
+	for k, v := range job.Options {
+		options[k] = v
+	}
+
+	printer := job.Printer
+	if printer == "" {
+		printer = DEFAULT_PRINTER_NAME
+	}
+	if err := ValidatePrinterName(printer); err != nil {
+		return nil, err
+	}
+
+	args := []string{copiesFlag, fmt.Sprint(job.Quantity)}
+	// sort the options so the command is the same every time
+	for _, k := range sortedKeys(options) {
+		args = append(args, "-o", k+"="+options[k])
+	}
+
+	return append(args, printerFlag, printer, job.FilePathName), nil
+}
+
+// Build the arguments for every print command needed to print the job, in the order they should run
+//
+// This is a single command unless the job asks for a cut between copies, in which case each copy is printed separately.
+func PrintCommands(backend string, job PrintJob) ([][]string, error) {
+
+	runs := 1
+	if job.CutBetweenCopies {
+		runs, job.Quantity = job.Quantity, 1
+	}
+
+	args, err := PrintCommandArgs(backend, job)
 	if err != nil {
 		return nil, err
 	}
 
-	// use linux "lp" program to print the newly minted PDF
-	return exec.Command("lp",
-		"-n", fmt.Sprint(quantity),
-		"-o", "Collate=True",
-		"-o", "orientation-requested=4", // rotate print by 90°
-		"-d", "dymo",
-		filePathName,
-	).Output()
+	commands := make([][]string, runs)
+	for i := range commands {
+		commands[i] = args
+	}
+
+	return commands, nil
+}
+
+func printWithBackend(ctx context.Context, backend string, job PrintJob) ([]byte, error) {
+
+	filePathName, err := filepath.Abs(job.FilePathName)
+	if err != nil {
+		return nil, err
+	}
+	job.FilePathName = filePathName
+
+	commands, err := PrintCommands(backend, job)
+	if err != nil {
+		return nil, err
+	}
+
+	// use the system print program to print the newly minted PDF; stop at the first failure rather than printing a partial run twice
+	var out []byte
+	for i, args := range commands {
+		o, err := runPrintCommand(ctx, job.CopyTimeout, backend, args)
+		out = append(out, o...)
+		if err != nil && i > 0 {
+			return out, &PartialPrintError{Printed: i, Total: len(commands), Err: err}
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+// run one print command, killing it after `timeout` (if set) or when `ctx` ends
+func runPrintCommand(ctx context.Context, timeout time.Duration, backend string, args []string) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	out, err := exec.CommandContext(ctx, backend, args...).Output()
+	// a killed command only reports "signal: killed"; say why it was killed so callers can tell a timeout from a failure
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+
+	return out, err
+}
+
+// Returned when a job printed as several commands fails partway through; the first `Printed` copies were sent to the printer
+//
+// Clients retrying the job would print those copies again, so they need to be told.
+type PartialPrintError struct {
+	Printed int
+	Total   int
+	Err     error
+}
+
+func (e *PartialPrintError) Error() string {
+	return fmt.Sprintf("printed %v of %v copies: %v", e.Printed, e.Total, e.Err)
+}
+
+func (e *PartialPrintError) Unwrap() error {
+	return e.Err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// lp reports the job it queued as e.g. "request id is dymo-42 (1 file(s))"
+var cupsJobIdPattern = regexp.MustCompile(`request id is (\S+)`)
+
+// Extract the CUPS job ID from the output of the print command; returns "" if there isn't one (e.g. lpr prints nothing)
+func ParseCupsJobId(out []byte) string {
+	m := cupsJobIdPattern.FindSubmatch(out)
+	if m == nil {
+		return ""
+	}
+
+	return string(m[1])
+}
+
+// use system commands to confirm the printer is known to CUPS and accepting jobs
+//
+// lpstat is killed if `ctx` ends first, so a hung CUPS daemon can't hold up the caller.
+func CheckPrinter(ctx context.Context, printerName string) error {
+
+	// "lpstat -p" exits non-zero if CUPS isn't running or doesn't know about the printer
+	out, err := exec.CommandContext(ctx, "lpstat", "-p", printerName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lpstat failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if strings.Contains(string(out), "disabled") {
+		return errors.New("printer is disabled: " + strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// ensure the spool directory exists (creating it if necessary) and that files can be written to it
+func ValidateSpoolDir(dir string) error {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create spool directory %v: %w", dir, err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("spool directory is not a directory: " + dir)
+	}
+
+	// the only reliable way to know a directory is writable is to write to it
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("spool directory %v is not writable: %w", dir, err)
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
 }
@@ -0,0 +1,251 @@
+package system_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"src/internal/system"
+	"testing"
+	"time"
+)
+
+// each backend should receive the flags it understands
+func TestPrintCommandArgs(t *testing.T) {
+	tests := map[string][]string{
+		system.BACKEND_LP:  {"-n", "3", "-o", "Collate=True", "-o", "orientation-requested=4", "-d", "dymo", "/tmp/label.pdf"},
+		system.BACKEND_LPR: {"-#", "3", "-o", "Collate=True", "-o", "orientation-requested=4", "-P", "dymo", "/tmp/label.pdf"},
+	}
+
+	for backend, want := range tests {
+		got, err := system.PrintCommandArgs(backend, system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 3})
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", backend, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: unexpected arguments:\ngot:  %q\nwant: %q", backend, got, want)
+		}
+	}
+
+	if _, err := system.PrintCommandArgs("lpd", system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 3}); err == nil {
+		t.Error("expected an error for an unsupported backend")
+	}
+
+	// requested options are added to the defaults, or replace them
+	got, err := system.PrintCommandArgs(system.BACKEND_LP, system.PrintJob{
+		FilePathName: "/tmp/label.pdf",
+		Quantity:     1,
+		Options:      map[string]string{"media": "w79h252", "Collate": "False"},
+	})
+	want := []string{"-n", "1", "-o", "Collate=False", "-o", "media=w79h252", "-o", "orientation-requested=4", "-d", "dymo", "/tmp/label.pdf"}
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected arguments with options:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	// the job's printer replaces the default
+	got, err = system.PrintCommandArgs(system.BACKEND_LPR, system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 1, Printer: "zebra"})
+	if err != nil || got[len(got)-2] != "zebra" {
+		t.Errorf("expected the job's printer to be used: %q %v", got, err)
+	}
+	if _, err := system.PrintCommandArgs(system.BACKEND_LP, system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 1, Printer: "-h evil"}); err == nil {
+		t.Error("expected an error for an invalid printer name")
+	}
+
+	// disallowed options never reach the command
+	if _, err := system.PrintCommandArgs(system.BACKEND_LP, system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 1, Options: map[string]string{"job-hold-until": "indefinite"}}); err == nil {
+		t.Error("expected an error for a disallowed option")
+	}
+}
+
+func TestValidatePrintOptions(t *testing.T) {
+	valid := []map[string]string{
+		nil,
+		{"media": "w79h252"},
+		{"Collate": "True", "print-quality": "5", "fit-to-page": "true"},
+	}
+	for _, o := range valid {
+		if err := system.ValidatePrintOptions(o); err != nil {
+			t.Errorf("%v: unexpected error: %v", o, err)
+		}
+	}
+
+	invalid := []map[string]string{
+		// not on the allowlist
+		{"job-hold-until": "indefinite"},
+		{"printer-is-shared": "true"},
+		// lp would read these as several options
+		{"media": "w79h252 job-hold-until=indefinite"},
+		{"media": "a,b=c"},
+		{"media": ""},
+	}
+	for _, o := range invalid {
+		if err := system.ValidatePrintOptions(o); err == nil {
+			t.Errorf("%v: expected an error", o)
+		}
+	}
+}
+
+func TestValidatePrintBackend(t *testing.T) {
+	if err := system.ValidatePrintBackend("cat"); err == nil {
+		t.Error("expected an error for an unsupported backend")
+	}
+}
+
+func TestParseCupsJobId(t *testing.T) {
+	tests := map[string]string{
+		"request id is dymo-42 (1 file(s))\n": "dymo-42",
+		"request id is dymo-7":                "dymo-7",
+		"":                                    "",
+		"lp: error - no default destination":  "",
+	}
+
+	for out, want := range tests {
+		if got := system.ParseCupsJobId([]byte(out)); got != want {
+			t.Errorf("ParseCupsJobId(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
+
+func TestFreeDiskSpace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("free disk space is only reported on Linux and macOS")
+	}
+
+	if free, err := system.FreeDiskSpace(t.TempDir()); err != nil || free == 0 {
+		t.Errorf("expected free space on the temp directory's filesystem, got %v %v", free, err)
+	}
+
+	if _, err := system.FreeDiskSpace(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a directory that doesn't exist")
+	}
+}
+
+// cutting between copies should print each copy as its own job; otherwise all copies go in one job
+func TestPrintCommands(t *testing.T) {
+	job := system.PrintJob{FilePathName: "/tmp/label.pdf", Quantity: 3}
+	single := []string{"-n", "1", "-o", "Collate=True", "-o", "orientation-requested=4", "-d", "dymo", "/tmp/label.pdf"}
+
+	commands, err := system.PrintCommands(system.BACKEND_LP, job)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(commands) != 1 || commands[0][1] != "3" {
+		t.Errorf("expected one command printing 3 copies, got %q", commands)
+	}
+
+	job.CutBetweenCopies = true
+	commands, err = system.PrintCommands(system.BACKEND_LP, job)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 commands, got %q", commands)
+	}
+	for i, args := range commands {
+		if !reflect.DeepEqual(args, single) {
+			t.Errorf("command %v: got %q want %q", i, args, single)
+		}
+	}
+
+	// the job is still validated
+	job.Options = map[string]string{"job-sheets": "none"}
+	if _, err := system.PrintCommands(system.BACKEND_LP, job); err == nil {
+		t.Error("expected an error for an unsupported option")
+	}
+}
+
+// a cut run that times out partway should report how many copies reached the printer
+func TestPrintPdf_PartialCutRun(t *testing.T) {
+	// a fake lp which queues two copies, then hangs on the third
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	fakeCommand(t, dir, "lp", "echo >> "+count+"\n"+
+		"[ $(wc -l < "+count+") -lt 3 ] || exec sleep 10\n"+
+		"echo 'request id is dymo-42 (1 file(s))'")
+
+	printPdf, err := system.NewPdfPrinter(system.BACKEND_LP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	out, err := printPdf(ctx, system.PrintJob{FilePathName: filepath.Join(dir, "label.pdf"), Quantity: 5, CutBetweenCopies: true})
+
+	var partial *system.PartialPrintError
+	if !errors.As(err, &partial) || partial.Printed != 2 || partial.Total != 5 {
+		t.Fatalf("expected 2 of 5 copies to be reported as printed, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("the hung print command should have run until the deadline")
+	}
+	if system.ParseCupsJobId(out) != "dymo-42" {
+		t.Errorf("output of the copies that printed is missing: %q", out)
+	}
+}
+
+// every copy in a cut run gets its own timeout, so a hung copy is killed without waiting out the whole job
+func TestPrintPdf_CopyTimeout(t *testing.T) {
+	// a fake lp which takes a while to queue each copy, then hangs on the third
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	fakeCommand(t, dir, "lp", "echo >> "+count+"\n"+
+		"sleep 0.2\n"+
+		"[ $(wc -l < "+count+") -lt 3 ] || exec sleep 10\n"+
+		"echo 'request id is dymo-42 (1 file(s))'")
+
+	printPdf, err := system.NewPdfPrinter(system.BACKEND_LP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = printPdf(ctx, system.PrintJob{FilePathName: filepath.Join(dir, "label.pdf"), Quantity: 5, CutBetweenCopies: true, CopyTimeout: 300 * time.Millisecond})
+
+	// the first two copies take longer than one timeout between them, but each finishes within its own
+	var partial *system.PartialPrintError
+	if !errors.As(err, &partial) || partial.Printed != 2 || partial.Total != 5 {
+		t.Fatalf("expected 2 of 5 copies to be reported as printed, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a killed copy should be reported as a timeout: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the hung copy should have been killed long before the job's deadline")
+	}
+}
+
+// a hung CUPS daemon shouldn't hold up the printer check past its deadline
+func TestCheckPrinter_Timeout(t *testing.T) {
+	fakeCommand(t, t.TempDir(), "lpstat", "exec sleep 10")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := system.CheckPrinter(ctx, "dymo"); err == nil {
+		t.Error("expected an error for a printer check that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("printer check ran for %v after its deadline", elapsed)
+	}
+}
+
+// put a shell script named `name` first on the PATH for the rest of the test
+func fakeCommand(t *testing.T, dir string, name string, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -2,56 +2,118 @@
 package utils
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"src/internal/pdf"
+	"src/internal/system"
+	"sync"
 	"testing"
 )
 
 //go:embed assets/test-label.pdf
-var pdf []byte
+var testLabelPdf []byte
 
 // # Mock of the PDF generation function
 //
 // To induce a failure:
 //   - labelText length > 64 characters
-//   - labelText == "PDF GENERATION FAIL - WRITE ERROR"
-func MockGeneratePdf(labelText string, dateDescriptor string) ([]byte, error) {
+//   - labelText == "PDF GEN FAIL"
+func MockGeneratePdf(labelText string, dateDescriptor string, opts pdf.Options) ([]byte, error) {
 	fmt.Println("generatePdf mock function called")
 
 	if len(labelText) > 64 {
 		return nil, errors.New("labelText value too long")
 	}
 
-	if labelText == "PDF GENERATION FAIL - WRITE ERROR" {
+	if labelText == "PDF GEN FAIL" {
 		return nil, errors.New("error writing pdf")
 	}
 
-	return pdf, nil
+	return testLabelPdf, nil
 }
 
 // # Mock of the PDF printing function
 //
 // To induce a failure:
 //   - pass a quantity >= 100
-func MockPrintPdf(quantity int, filePathName string) ([]byte, error) {
+//   - pass a cancelled context
+func MockPrintPdf(ctx context.Context, job system.PrintJob) ([]byte, error) {
 	fmt.Println("printPdf mock function called")
 
-	if quantity == 0 || quantity >= 100 {
-		return []byte("exit code 5"), errors.New(fmt.Sprintf("Invalid label quantity: %v", quantity))
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return []byte("exit code 0"), nil
+	if job.Quantity == 0 || job.Quantity >= 100 {
+		return []byte("exit code 5"), errors.New(fmt.Sprintf("Invalid label quantity: %v", job.Quantity))
+	}
+
+	return []byte("request id is dymo-42 (1 file(s))"), nil
+}
+
+// # Mock of the print job ID generator
+//
+// Always returns "test-job" so responses can be compared exactly.
+func MockNewJobId() string {
+	return "test-job"
+}
+
+type LogEntry struct {
+	Level         string
+	Msg           string
+	KeysAndValues []any
+}
+
+// Get the value logged for `key`, or nil if it wasn't logged
+func (e LogEntry) Value(key string) any {
+	for i := 0; i+1 < len(e.KeysAndValues); i += 2 {
+		if e.KeysAndValues[i] == key {
+			return e.KeysAndValues[i+1]
+		}
+	}
+
+	return nil
+}
+
+// # Mock of the server's structured logger
+//
+// Records every entry so tests can assert which events were logged.
+type MockLogger struct {
+	mu      sync.Mutex
+	Entries []LogEntry
+}
+
+func (l *MockLogger) Info(ctx context.Context, msg string, keysAndValues ...any) {
+	l.record("INFO", msg, keysAndValues)
+}
+
+func (l *MockLogger) Warn(ctx context.Context, msg string, keysAndValues ...any) {
+	l.record("WARN", msg, keysAndValues)
+}
+
+func (l *MockLogger) Error(ctx context.Context, msg string, keysAndValues ...any) {
+	l.record("ERROR", msg, keysAndValues)
+}
+
+func (l *MockLogger) record(level string, msg string, keysAndValues []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Entries = append(l.Entries, LogEntry{Level: level, Msg: msg, KeysAndValues: keysAndValues})
 }
 
 type RequestParams struct {
 	ReqMethod          string
 	ReqBody            io.Reader
+	ReqHeaders         map[string]string
 	ExpectedStatusCode int
 	ExpectedMessage    string
+	// optional: only checked when non-empty
+	ExpectedContentType string
 }
 
 func RequestTester(t *testing.T, testRequests []RequestParams, handler func(w http.ResponseWriter, r *http.Request)) {
@@ -66,6 +128,9 @@ func RequestTester(t *testing.T, testRequests []RequestParams, handler func(w ht
 			t.Log(err)
 			t.Fail()
 		}
+		for k, v := range a.ReqHeaders {
+			req.Header.Set(k, v)
+		}
 		requests = append(requests, req)
 	}
 
@@ -73,6 +138,7 @@ func RequestTester(t *testing.T, testRequests []RequestParams, handler func(w ht
 	for i, r := range requests[:] {
 		expectedStatusCode := testRequests[i].ExpectedStatusCode
 		expectedMessage := testRequests[i].ExpectedMessage
+		expectedContentType := testRequests[i].ExpectedContentType
 
 		// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 		rr := httptest.NewRecorder()
@@ -91,5 +157,10 @@ func RequestTester(t *testing.T, testRequests []RequestParams, handler func(w ht
 			t.Errorf("handler returned unexpected message: \ngot: %v\nwant: %v",
 				rr.Body.String(), expectedMessage)
 		}
+		// Check the Content-Type header, if the test case specifies one.
+		if ct := rr.Header().Get("Content-Type"); expectedContentType != "" && ct != expectedContentType {
+			t.Errorf("handler returned unexpected Content-Type: got %v want %v",
+				ct, expectedContentType)
+		}
 	}
 }
@@ -6,7 +6,15 @@ import (
 )
 
 func main() {
-	s := server.InitializeServer()
+	s, err := server.InitializeServer()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the certificate is already loaded into TLSConfig, so no files are passed here
+	if s.TLSConfig != nil {
+		log.Fatal(s.ListenAndServeTLS("", ""))
+	}
 
 	log.Fatal(s.ListenAndServe())
 }